@@ -121,6 +121,35 @@ func (r *RedisCacheClient) SetNX(ctx context.Context, key string, value interfac
 	return nil
 }
 
+// TrySet sets key like SetNX and reports whether it was set, false when the key already exists.
+func (r *RedisCacheClient) TrySet(ctx context.Context, key string, value interface{},
+	expiration time.Duration) (set bool, err error) {
+	var byteValue []byte
+	startTime := time.Now()
+	fullKey := getFullKey(r.prefix, key)
+	fullKeyByte, _ := json.Marshal(fullKey)
+	if byteValue, err = json.Marshal(value); err != nil {
+		logger.Error("json.Marshal redis value: %v, error: %v", value, err)
+		return false, err
+	}
+	localExpiration := int(expiration.Seconds())
+	expiration = r.unstableExpiry.AroundDuration(expiration)
+	set, err = r.client.SetNX(ctx, fullKey, byteValue, expiration).Result()
+	elapsed := time.Since(startTime).Milliseconds()
+	for _, p := range r.plugins {
+		p.OnSetRequestEnd(ctx, cmdSetNX, elapsed, fullKey, err)
+	}
+	if err != nil {
+		logger.Error("set redis key: %v, error: %v", fullKey, err)
+		return false, err
+	}
+	if set {
+		// only the winner caches the value, the key holds the value of another caller otherwise
+		_ = r.localCache.Set(fullKeyByte, byteValue, localExpiration)
+	}
+	return set, nil
+}
+
 func (r *RedisCacheClient) Get(ctx context.Context, key string, fetch fetchFunc) (result []byte, err error) {
 	var byteValue []byte
 	fullKey := getFullKey(r.prefix, key)
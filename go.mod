@@ -19,6 +19,8 @@ require (
 	github.com/zeromicro/go-zero v1.5.6
 	go.uber.org/atomic v1.10.0
 	golang.org/x/net v0.23.0
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -49,5 +51,4 @@ require (
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
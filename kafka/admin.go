@@ -0,0 +1,252 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+var _ Admin = (*admin)(nil)
+
+var (
+	ErrGroupActive = errors.New("kafka: consumer group has active members")
+)
+
+// PartitionLag is how far a consumer group is behind the end of a partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed is the next offset the group reads, -1 when it has not committed any.
+	Committed int64
+	// Latest is the offset of the next produced message.
+	Latest int64
+	// Lag counts the messages from Committed to Latest, or every retained message without commit.
+	Lag int64
+}
+
+// Admin manages the topics and consumer groups of a cluster.
+type Admin interface {
+	// EnsureTopic creates topic when it does not exist, and adds partitions when it has fewer.
+	// The configs of an existing topic are left as they are.
+	EnsureTopic(ctx context.Context, topic string, partitions int32, replicationFactor int16,
+		configs map[string]string) error
+	ListTopics(ctx context.Context) (map[string]sarama.TopicDetail, error)
+	DescribeTopics(ctx context.Context, topics ...string) ([]*sarama.TopicMetadata, error)
+	DescribeConsumerGroups(ctx context.Context, groupIDs ...string) ([]*sarama.GroupDescription, error)
+	// Lag returns the lag of every partition of topics, or of the topics the group committed to when none is given.
+	Lag(ctx context.Context, groupID string, topics ...string) ([]*PartitionLag, error)
+	// ResetOffsetsToEarliest moves the group to the oldest retained message of every partition of topic
+	// and returns the new offsets. The group must have no active member, see ErrGroupActive.
+	ResetOffsetsToEarliest(ctx context.Context, groupID, topic string) (map[int32]int64, error)
+	// ResetOffsetsToLatest moves the group to the end of every partition of topic, see ResetOffsetsToEarliest.
+	ResetOffsetsToLatest(ctx context.Context, groupID, topic string) (map[int32]int64, error)
+	// ResetOffsetsToTime moves the group to the first message produced at or after t,
+	// or to the end of the partitions without one, see ResetOffsetsToEarliest.
+	ResetOffsetsToTime(ctx context.Context, groupID, topic string, t time.Time) (map[int32]int64, error)
+	Close() error
+}
+
+type admin struct {
+	client sarama.Client
+	admin  sarama.ClusterAdmin
+}
+
+// NewAdmin Build new kafka admin
+func NewAdmin(ctx context.Context, brokers []string, username, password string, options ...Option) (Admin, error) {
+	opts := &Options{}
+	for _, option := range options {
+		option(opts)
+	}
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_3_0_0
+	applyNetConfig(config, username, password, opts)
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	clusterAdmin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &admin{
+		client: client,
+		admin:  clusterAdmin,
+	}, nil
+}
+
+// NewAdminFromConfig builds an admin from c, see NewProducerFromConfig.
+func NewAdminFromConfig(ctx context.Context, c *Config, options ...Option) (Admin, error) {
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewAdmin(ctx, c.Brokers, c.SASL.Username, c.SASL.Password, append(opts, options...)...)
+}
+
+func (a *admin) EnsureTopic(ctx context.Context, topic string, partitions int32, replicationFactor int16,
+	configs map[string]string) error {
+	metadata, err := a.admin.DescribeTopics([]string{topic})
+	if err != nil {
+		return err
+	}
+	if len(metadata) == 1 && metadata[0].Err == sarama.ErrNoError {
+		if int32(len(metadata[0].Partitions)) >= partitions {
+			return nil
+		}
+		return a.admin.CreatePartitions(topic, partitions, nil, false)
+	}
+	detail := &sarama.TopicDetail{
+		NumPartitions:     partitions,
+		ReplicationFactor: replicationFactor,
+		ConfigEntries:     make(map[string]*string, len(configs)),
+	}
+	for name, value := range configs {
+		value := value
+		detail.ConfigEntries[name] = &value
+	}
+	err = a.admin.CreateTopic(topic, detail, false)
+	if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+func (a *admin) ListTopics(ctx context.Context) (map[string]sarama.TopicDetail, error) {
+	return a.admin.ListTopics()
+}
+
+func (a *admin) DescribeTopics(ctx context.Context, topics ...string) ([]*sarama.TopicMetadata, error) {
+	return a.admin.DescribeTopics(topics)
+}
+
+func (a *admin) DescribeConsumerGroups(ctx context.Context, groupIDs ...string) ([]*sarama.GroupDescription,
+	error) {
+	return a.admin.DescribeConsumerGroups(groupIDs)
+}
+
+func (a *admin) Lag(ctx context.Context, groupID string, topics ...string) ([]*PartitionLag, error) {
+	var topicPartitions map[string][]int32
+	if len(topics) > 0 {
+		topicPartitions = make(map[string][]int32, len(topics))
+		for _, topic := range topics {
+			partitions, err := a.client.Partitions(topic)
+			if err != nil {
+				return nil, err
+			}
+			topicPartitions[topic] = partitions
+		}
+	}
+	offsets, err := a.admin.ListConsumerGroupOffsets(groupID, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, offsets.Err
+	}
+	var lags []*PartitionLag
+	for topic, blocks := range offsets.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("kafka: fetch offset of %s/%d: %w", topic, partition, block.Err)
+			}
+			lag := &PartitionLag{
+				Topic:     topic,
+				Partition: partition,
+				Committed: block.Offset,
+			}
+			if lag.Latest, err = a.client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+				return nil, err
+			}
+			from := lag.Committed
+			if from < 0 {
+				if from, err = a.client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+					return nil, err
+				}
+			}
+			lag.Lag = lag.Latest - from
+			lags = append(lags, lag)
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+func (a *admin) ResetOffsetsToEarliest(ctx context.Context, groupID, topic string) (map[int32]int64, error) {
+	return a.resetOffsets(groupID, topic, sarama.OffsetOldest)
+}
+
+func (a *admin) ResetOffsetsToLatest(ctx context.Context, groupID, topic string) (map[int32]int64, error) {
+	return a.resetOffsets(groupID, topic, sarama.OffsetNewest)
+}
+
+func (a *admin) ResetOffsetsToTime(ctx context.Context, groupID, topic string, t time.Time) (map[int32]int64,
+	error) {
+	return a.resetOffsets(groupID, topic, t.UnixNano()/int64(time.Millisecond))
+}
+
+// resetOffsets commits the offsets found for position, sarama.OffsetOldest, sarama.OffsetNewest or a timestamp in ms.
+func (a *admin) resetOffsets(groupID, topic string, position int64) (map[int32]int64, error) {
+	groups, err := a.admin.DescribeConsumerGroups([]string{groupID})
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if len(group.Members) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrGroupActive, groupID)
+		}
+	}
+	partitions, err := a.client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	request := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           groupID,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	offsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		offset, err := a.client.GetOffset(topic, partition, position)
+		if err != nil {
+			return nil, err
+		}
+		if offset < 0 {
+			// no message at or after the timestamp
+			if offset, err = a.client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+				return nil, err
+			}
+		}
+		offsets[partition] = offset
+		request.AddBlock(topic, partition, offset, 0, "")
+	}
+	coordinator, err := a.client.Coordinator(groupID)
+	if err != nil {
+		return nil, err
+	}
+	response, err := coordinator.CommitOffset(request)
+	if err != nil {
+		return nil, err
+	}
+	for partition, kerr := range response.Errors[topic] {
+		if kerr != sarama.ErrNoError {
+			return nil, fmt.Errorf("kafka: commit offset of %s/%d: %w", topic, partition, kerr)
+		}
+	}
+	return offsets, nil
+}
+
+func (a *admin) Close() error {
+	// closing the cluster admin closes the client
+	return a.admin.Close()
+}
@@ -0,0 +1,162 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAdmin(t *testing.T, handlers map[string]sarama.MockResponse) (*sarama.MockBroker, Admin) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	metadata, ok := handlers["MetadataRequest"].(*sarama.MockMetadataResponse)
+	if !ok {
+		metadata = sarama.NewMockMetadataResponse(t)
+		handlers["MetadataRequest"] = metadata
+	}
+	metadata.SetController(broker.BrokerID()).SetBroker(broker.Addr(), broker.BrokerID())
+	handlers["FindCoordinatorRequest"] = sarama.NewMockFindCoordinatorResponse(t).
+		SetCoordinator(sarama.CoordinatorGroup, "group", broker)
+	broker.SetHandlerByMap(handlers)
+	a, err := NewAdmin(context.Background(), []string{broker.Addr()}, "", "")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	return broker, a
+}
+
+// requests returns the requests of type R the broker received.
+func requests[R any](broker *sarama.MockBroker) []R {
+	var found []R
+	for _, rr := range broker.History() {
+		if request, ok := rr.Request.(R); ok {
+			found = append(found, request)
+		}
+	}
+	return found
+}
+
+func TestAdminEnsureTopic(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		a := assert.New(t)
+		broker, admin := newMockAdmin(t, map[string]sarama.MockResponse{
+			"CreateTopicsRequest": sarama.NewMockCreateTopicsResponse(t),
+		})
+		a.NoError(admin.EnsureTopic(ctx, "test", 3, 1, map[string]string{"retention.ms": "1000"}))
+		created := requests[*sarama.CreateTopicsRequest](broker)
+		if a.Len(created, 1) {
+			detail := created[0].TopicDetails["test"]
+			a.Equal(int32(3), detail.NumPartitions)
+			a.Equal(int16(1), detail.ReplicationFactor)
+			a.Equal("1000", *detail.ConfigEntries["retention.ms"])
+		}
+	})
+
+	t.Run("add partitions", func(t *testing.T) {
+		a := assert.New(t)
+		broker, admin := newMockAdmin(t, map[string]sarama.MockResponse{
+			"MetadataRequest":         sarama.NewMockMetadataResponse(t).SetLeader("test", 0, 1),
+			"CreatePartitionsRequest": sarama.NewMockCreatePartitionsResponse(t),
+		})
+		a.NoError(admin.EnsureTopic(ctx, "test", 1, 1, nil))
+		a.Empty(requests[*sarama.CreatePartitionsRequest](broker))
+
+		a.NoError(admin.EnsureTopic(ctx, "test", 3, 1, nil))
+		partitions := requests[*sarama.CreatePartitionsRequest](broker)
+		if a.Len(partitions, 1) {
+			a.Equal(int32(3), partitions[0].TopicPartitions["test"].Count)
+		}
+		a.Empty(requests[*sarama.CreateTopicsRequest](broker))
+	})
+}
+
+func TestAdminLag(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	_, admin := newMockAdmin(t, map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetLeader("test", 0, 1).
+			SetLeader("test", 1, 1),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "test", 0, 5, "", sarama.ErrNoError).
+			SetOffset("group", "test", 1, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("test", 0, sarama.OffsetNewest, 12).
+			SetOffset("test", 1, sarama.OffsetNewest, 30).
+			SetOffset("test", 1, sarama.OffsetOldest, 10),
+	})
+
+	lags, err := admin.Lag(ctx, "group", "test")
+	a.NoError(err)
+	a.Equal([]*PartitionLag{
+		{Topic: "test", Partition: 0, Committed: 5, Latest: 12, Lag: 7},
+		{Topic: "test", Partition: 1, Committed: -1, Latest: 30, Lag: 20},
+	}, lags)
+
+	lags, err = admin.Lag(ctx, "group")
+	a.NoError(err)
+	a.Len(lags, 2)
+}
+
+func TestAdminResetOffsets(t *testing.T) {
+	ctx := context.Background()
+	at := time.Unix(1700000000, 0)
+	handlers := func(t *testing.T, group *sarama.GroupDescription) map[string]sarama.MockResponse {
+		return map[string]sarama.MockResponse{
+			"MetadataRequest": sarama.NewMockMetadataResponse(t).
+				SetLeader("test", 0, 1).
+				SetLeader("test", 1, 1),
+			"DescribeGroupsRequest": sarama.NewMockDescribeGroupsResponse(t).AddGroupDescription("group", group),
+			"OffsetRequest": sarama.NewMockOffsetResponse(t).
+				SetOffset("test", 0, sarama.OffsetOldest, 2).
+				SetOffset("test", 1, sarama.OffsetOldest, 3).
+				SetOffset("test", 0, sarama.OffsetNewest, 12).
+				SetOffset("test", 1, sarama.OffsetNewest, 30).
+				SetOffset("test", 0, at.UnixNano()/int64(time.Millisecond), 8).
+				SetOffset("test", 1, at.UnixNano()/int64(time.Millisecond), -1),
+			"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		}
+	}
+
+	t.Run("inactive group", func(t *testing.T) {
+		a := assert.New(t)
+		broker, admin := newMockAdmin(t, handlers(t, &sarama.GroupDescription{GroupId: "group", State: "Empty"}))
+
+		offsets, err := admin.ResetOffsetsToEarliest(ctx, "group", "test")
+		a.NoError(err)
+		a.Equal(map[int32]int64{0: 2, 1: 3}, offsets)
+
+		offsets, err = admin.ResetOffsetsToLatest(ctx, "group", "test")
+		a.NoError(err)
+		a.Equal(map[int32]int64{0: 12, 1: 30}, offsets)
+
+		// partition 1 has no message after at and moves to its end
+		offsets, err = admin.ResetOffsetsToTime(ctx, "group", "test", at)
+		a.NoError(err)
+		a.Equal(map[int32]int64{0: 8, 1: 30}, offsets)
+
+		commits := requests[*sarama.OffsetCommitRequest](broker)
+		if a.Len(commits, 3) {
+			a.Equal("group", commits[0].ConsumerGroup)
+			a.Equal(int32(sarama.GroupGenerationUndefined), commits[0].ConsumerGroupGeneration)
+		}
+	})
+
+	t.Run("active group", func(t *testing.T) {
+		a := assert.New(t)
+		broker, admin := newMockAdmin(t, handlers(t, &sarama.GroupDescription{
+			GroupId: "group",
+			State:   "Stable",
+			Members: map[string]*sarama.GroupMemberDescription{"member": {ClientId: "client"}},
+		}))
+		_, err := admin.ResetOffsetsToEarliest(ctx, "group", "test")
+		a.ErrorIs(err, ErrGroupActive)
+		a.Empty(requests[*sarama.OffsetCommitRequest](broker))
+	})
+}
@@ -0,0 +1,251 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	defaultMaxInFlight = 1024
+)
+
+var _ AsyncProducer = (*asyncProducer)(nil)
+
+var (
+	ErrProducerClosed = errors.New("kafka: producer closed")
+)
+
+// Result is the outcome of an asynchronous send.
+type Result struct {
+	Message   *sarama.ProducerMessage
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// Callback receives the result of an asynchronous send, it is called from the goroutine reading
+// the results so it must not block, a panic is recovered and logged.
+type Callback func(result *Result)
+
+// AsyncProducer batches messages in the background instead of waiting for every broker round trip.
+// The AsyncProduce methods block while the in-flight messages reach the WithMaxInFlight bound.
+type AsyncProducer interface {
+	AsyncProduce(ctx context.Context, topic string, message []byte, callback Callback) error
+	AsyncProduceWithKey(ctx context.Context, topic string, key string, message []byte, callback Callback) error
+	AsyncProduceWithKeyHeader(ctx context.Context, topic string, key string, message []byte,
+		headers []sarama.RecordHeader, callback Callback) error
+	// AsyncProduceMessage returns a channel receiving the result of msg.
+	AsyncProduceMessage(ctx context.Context, msg *sarama.ProducerMessage) (<-chan *Result, error)
+	// Flush waits until every message sent so far got its result.
+	Flush(ctx context.Context) error
+	// Close flushes and stops the producer, sends fail with ErrProducerClosed afterwards.
+	Close(ctx context.Context) error
+}
+
+type asyncProducer struct {
+	producer sarama.AsyncProducer
+	slots    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	flushMu  sync.Mutex
+	inFlight int
+	idle     chan struct{}
+
+	results sync.WaitGroup
+}
+
+// pending is the Metadata of the messages in flight, the metadata of the caller is put back
+// before the callback runs.
+type pending struct {
+	metadata interface{}
+	callback Callback
+}
+
+// NewAsyncProducer Build new kafka async producer
+func NewAsyncProducer(ctx context.Context, brokers []string, username, password string,
+	options ...Option) (AsyncProducer, error) {
+	opts := &Options{
+		maxInFlight: defaultMaxInFlight,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	kafkaConfig := newProducerConfig(username, password, opts)
+	kafkaConfig.Producer.Return.Errors = true
+	//default 100M, should <= server config
+	sarama.MaxRequestSize = MaxRequestSize
+	p, err := sarama.NewAsyncProducer(brokers, kafkaConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncProducer(p, opts.maxInFlight), nil
+}
+
+func newAsyncProducer(p sarama.AsyncProducer, maxInFlight int) *asyncProducer {
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlight
+	}
+	ap := &asyncProducer{
+		producer: p,
+		slots:    make(chan struct{}, maxInFlight),
+	}
+	ap.results.Add(2)
+	go ap.readSuccesses()
+	go ap.readErrors()
+	return ap
+}
+
+func (p *asyncProducer) AsyncProduce(ctx context.Context, topic string, message []byte, callback Callback) error {
+	return p.send(ctx, &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(message),
+	}, callback)
+}
+
+func (p *asyncProducer) AsyncProduceWithKey(ctx context.Context, topic string, key string, message []byte,
+	callback Callback) error {
+	return p.send(ctx, &sarama.ProducerMessage{
+		Key:   sarama.StringEncoder(key),
+		Topic: topic,
+		Value: sarama.ByteEncoder(message),
+	}, callback)
+}
+
+func (p *asyncProducer) AsyncProduceWithKeyHeader(ctx context.Context, topic string, key string, message []byte,
+	headers []sarama.RecordHeader, callback Callback) error {
+	return p.send(ctx, &sarama.ProducerMessage{
+		Key:     sarama.StringEncoder(key),
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(message),
+		Headers: headers,
+	}, callback)
+}
+
+func (p *asyncProducer) AsyncProduceMessage(ctx context.Context, msg *sarama.ProducerMessage) (<-chan *Result,
+	error) {
+	result := make(chan *Result, 1)
+	err := p.send(ctx, msg, func(r *Result) {
+		result <- r
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// send waits for a free slot and hands msg to sarama.
+func (p *asyncProducer) send(ctx context.Context, msg *sarama.ProducerMessage, callback Callback) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		<-p.slots
+		return ErrProducerClosed
+	}
+	p.track(1)
+	msg.Metadata = &pending{metadata: msg.Metadata, callback: callback}
+	select {
+	case p.producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		msg.Metadata = msg.Metadata.(*pending).metadata
+		p.track(-1)
+		<-p.slots
+		return ctx.Err()
+	}
+}
+
+// track counts the messages waiting for a result, idle is closed whenever there is none.
+func (p *asyncProducer) track(delta int) {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	p.inFlight += delta
+	switch {
+	case p.inFlight == 0 && p.idle != nil:
+		close(p.idle)
+		p.idle = nil
+	case p.inFlight > 0 && p.idle == nil:
+		p.idle = make(chan struct{})
+	}
+}
+
+func (p *asyncProducer) readSuccesses() {
+	defer p.results.Done()
+	for msg := range p.producer.Successes() {
+		p.done(&Result{Message: msg, Partition: msg.Partition, Offset: msg.Offset})
+	}
+}
+
+func (p *asyncProducer) readErrors() {
+	defer p.results.Done()
+	for err := range p.producer.Errors() {
+		p.done(&Result{Message: err.Msg, Partition: err.Msg.Partition, Offset: err.Msg.Offset, Err: err.Err})
+	}
+}
+
+func (p *asyncProducer) done(result *Result) {
+	pending, ok := result.Message.Metadata.(*pending)
+	if !ok {
+		log.Printf("kafka async producer got a result of unknown message. topic=[%s]", result.Message.Topic)
+		return
+	}
+	result.Message.Metadata = pending.metadata
+	defer func() {
+		p.track(-1)
+		<-p.slots
+	}()
+	if pending.callback != nil {
+		runCallback(pending.callback, result)
+	}
+}
+
+// runCallback logs a panic of callback, the result readers must keep running for Flush and Close to return.
+func runCallback(callback Callback, result *Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("kafka async producer callback panic. topic=[%s] err=[%v]", result.Message.Topic,
+				fmt.Errorf("kafka: callback panic: %v", r))
+		}
+	}()
+	callback(result)
+}
+
+func (p *asyncProducer) Flush(ctx context.Context) error {
+	p.flushMu.Lock()
+	idle := p.idle
+	p.flushMu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *asyncProducer) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+	err := p.Flush(ctx)
+	p.producer.AsyncClose()
+	p.results.Wait()
+	return err
+}
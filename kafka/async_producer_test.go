@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAsyncProducer(t *testing.T, maxInFlight int) (*mocks.AsyncProducer, *asyncProducer) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	mock := mocks.NewAsyncProducer(t, config)
+	return mock, newAsyncProducer(mock, maxInFlight)
+}
+
+func TestAsyncProducerResults(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mock, p := newMockAsyncProducer(t, 0)
+	produceErr := errors.New("produce")
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(produceErr)
+
+	result, err := p.AsyncProduceMessage(ctx, &sarama.ProducerMessage{
+		Topic:    "test",
+		Value:    sarama.StringEncoder("ok"),
+		Metadata: "metadata",
+	})
+	a.NoError(err)
+	r := <-result
+	a.NoError(r.Err)
+	a.Equal("metadata", r.Message.Metadata)
+
+	failed := make(chan *Result, 1)
+	a.NoError(p.AsyncProduceWithKey(ctx, "test", "key", []byte("fail"), func(r *Result) {
+		failed <- r
+	}))
+	a.ErrorIs((<-failed).Err, produceErr)
+
+	a.NoError(p.Close(ctx))
+	a.ErrorIs(p.AsyncProduce(ctx, "test", []byte("closed"), nil), ErrProducerClosed)
+	a.NoError(p.Close(ctx))
+}
+
+func TestAsyncProducerFlush(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	mock, p := newMockAsyncProducer(t, 1)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndSucceed()
+	a.NoError(p.Flush(ctx))
+
+	// the callback holds the only in-flight slot until release is closed
+	release := make(chan struct{})
+	a.NoError(p.AsyncProduce(ctx, "test", []byte("first"), func(r *Result) {
+		<-release
+	}))
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	a.ErrorIs(p.AsyncProduce(timeoutCtx, "test", []byte("blocked"), nil), context.DeadlineExceeded)
+	a.ErrorIs(p.Flush(timeoutCtx), context.DeadlineExceeded)
+
+	close(release)
+	a.NoError(p.Flush(ctx))
+	done := make(chan *Result, 1)
+	a.NoError(p.AsyncProduce(ctx, "test", []byte("second"), func(r *Result) {
+		done <- r
+	}))
+	a.NoError(p.Flush(ctx))
+	a.Len(done, 1)
+	a.NoError(p.Close(ctx))
+}
+
+func TestAsyncProducerCallbackPanic(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	mock, p := newMockAsyncProducer(t, 1)
+	mock.ExpectInputAndSucceed()
+	mock.ExpectInputAndFail(errors.New("produce"))
+	a.NoError(p.AsyncProduce(ctx, "test", []byte("success"), func(r *Result) {
+		panic("success callback")
+	}))
+	a.NoError(p.AsyncProduce(ctx, "test", []byte("error"), func(r *Result) {
+		panic("error callback")
+	}), "the slot of the panicking callback is released")
+	a.NoError(p.Flush(ctx))
+	a.NoError(p.Close(ctx))
+}
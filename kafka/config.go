@@ -0,0 +1,342 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Config describes the connection to a kafka cluster and the producers and consumers using it,
+// zero values keep the defaults.
+type Config struct {
+	Brokers      []string       `yaml:"brokers" json:"brokers"`
+	ClientID     string         `yaml:"client_id" json:"client_id"`
+	Version      string         `yaml:"version" json:"version"` // e.g. 2.8.0
+	DialTimeout  Duration       `yaml:"dial_timeout" json:"dial_timeout"`
+	ReadTimeout  Duration       `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout Duration       `yaml:"write_timeout" json:"write_timeout"`
+	SASL         SASLConfig     `yaml:"sasl" json:"sasl"`
+	TLS          TLSConfig      `yaml:"tls" json:"tls"`
+	Producer     ProducerConfig `yaml:"producer" json:"producer"`
+	Consumer     ConsumerConfig `yaml:"consumer" json:"consumer"`
+}
+
+// Duration is a time.Duration written like 5s or 100ms in YAML and JSON,
+// a JSON number is read as nanoseconds.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return d.UnmarshalText([]byte(text))
+	}
+	var nanoseconds int64
+	if err := json.Unmarshal(data, &nanoseconds); err != nil {
+		return err
+	}
+	*d = Duration(nanoseconds)
+	return nil
+}
+
+// SASLConfig authenticates with Username when it is set.
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism" json:"mechanism"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 (default)
+	Username  string `yaml:"username" json:"username"`
+	Password  string `yaml:"password" json:"password"`
+}
+
+// TLSConfig connects with TLS when Enable is set, CertFile and KeyFile hold the client cert.
+type TLSConfig struct {
+	Enable             bool   `yaml:"enable" json:"enable"`
+	CAFile             string `yaml:"ca_file" json:"ca_file"`
+	CertFile           string `yaml:"cert_file" json:"cert_file"`
+	KeyFile            string `yaml:"key_file" json:"key_file"`
+	ServerName         string `yaml:"server_name" json:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+type ProducerConfig struct {
+	RequiredAcks string   `yaml:"required_acks" json:"required_acks"` // none, local (default) or all
+	Compression  string   `yaml:"compression" json:"compression"`     // none, gzip, snappy, lz4 or zstd
+	Partitioner  string   `yaml:"partitioner" json:"partitioner"`     // hash (default), random, round_robin or manual
+	Timeout      Duration `yaml:"timeout" json:"timeout"`
+	Linger       Duration `yaml:"linger" json:"linger"`
+	BatchSize    int      `yaml:"batch_size" json:"batch_size"`
+	BatchBytes   int      `yaml:"batch_bytes" json:"batch_bytes"`
+	MaxInFlight  int      `yaml:"max_in_flight" json:"max_in_flight"`
+}
+
+type ConsumerConfig struct {
+	GroupID           string   `yaml:"group_id" json:"group_id"`
+	Topics            []string `yaml:"topics" json:"topics"`
+	InitialOffset     string   `yaml:"initial_offset" json:"initial_offset"` // newest (default) or oldest
+	SessionTimeout    Duration `yaml:"session_timeout" json:"session_timeout"`
+	MaxProcessingTime Duration `yaml:"max_processing_time" json:"max_processing_time"`
+	Concurrency       int      `yaml:"concurrency" json:"concurrency"`
+	ManualCommit      bool     `yaml:"manual_commit" json:"manual_commit"`
+}
+
+// Options returns the Option list matching the configured values.
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithVersion(version))
+	}
+	if c.ClientID != "" {
+		opts = append(opts, WithClientID(c.ClientID))
+	}
+	if c.DialTimeout > 0 {
+		opts = append(opts, WithDialTimeout(time.Duration(c.DialTimeout)))
+	}
+	if c.ReadTimeout > 0 {
+		opts = append(opts, WithReadTimeout(time.Duration(c.ReadTimeout)))
+	}
+	if c.WriteTimeout > 0 {
+		opts = append(opts, WithWriteTimeout(time.Duration(c.WriteTimeout)))
+	}
+	securityOpts, err := SecurityOptions(c.SASL.Mechanism, &c.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, securityOpts...)
+	producerOpts, err := c.Producer.options()
+	if err != nil {
+		return nil, err
+	}
+	consumerOpts, err := c.Consumer.options()
+	if err != nil {
+		return nil, err
+	}
+	return append(append(opts, producerOpts...), consumerOpts...), nil
+}
+
+// SecurityOptions returns the options of a SASL mechanism and a TLS config,
+// for the clients which read the connection settings outside Config.
+func SecurityOptions(saslMechanism string, tlsConfig *TLSConfig) ([]Option, error) {
+	var opts []Option
+	switch saslMechanism {
+	case "":
+	case sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256, sarama.SASLTypeSCRAMSHA512:
+		opts = append(opts, WithSASLMechanism(sarama.SASLMechanism(saslMechanism)))
+	default:
+		return nil, fmt.Errorf("kafka: invalid sasl mechanism %q", saslMechanism)
+	}
+	if tlsConfig != nil && tlsConfig.Enable {
+		config, err := tlsConfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLS(config))
+	}
+	return opts, nil
+}
+
+func (c *ProducerConfig) options() ([]Option, error) {
+	var opts []Option
+	switch c.RequiredAcks {
+	case "":
+	case "none":
+		opts = append(opts, WithRequiredAcks(sarama.NoResponse))
+	case "local":
+		opts = append(opts, WithRequiredAcks(sarama.WaitForLocal))
+	case "all":
+		opts = append(opts, WithRequiredAcks(sarama.WaitForAll))
+	default:
+		return nil, fmt.Errorf("kafka: invalid required_acks %q", c.RequiredAcks)
+	}
+	if c.Compression != "" {
+		var compression sarama.CompressionCodec
+		if err := compression.UnmarshalText([]byte(c.Compression)); err != nil {
+			return nil, fmt.Errorf("kafka: invalid compression %q", c.Compression)
+		}
+		opts = append(opts, WithCompression(compression))
+	}
+	switch c.Partitioner {
+	case "":
+	case "hash":
+		opts = append(opts, WithPartitioner(sarama.NewHashPartitioner))
+	case "random":
+		opts = append(opts, WithPartitioner(sarama.NewRandomPartitioner))
+	case "round_robin":
+		opts = append(opts, WithPartitioner(sarama.NewRoundRobinPartitioner))
+	case "manual":
+		opts = append(opts, WithPartitioner(sarama.NewManualPartitioner))
+	default:
+		return nil, fmt.Errorf("kafka: invalid partitioner %q", c.Partitioner)
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, WithProducerTimeout(time.Duration(c.Timeout)))
+	}
+	if c.Linger > 0 {
+		opts = append(opts, WithLinger(time.Duration(c.Linger)))
+	}
+	if c.BatchSize > 0 {
+		opts = append(opts, WithBatchSize(c.BatchSize))
+	}
+	if c.BatchBytes > 0 {
+		opts = append(opts, WithBatchBytes(c.BatchBytes))
+	}
+	if c.MaxInFlight > 0 {
+		opts = append(opts, WithMaxInFlight(c.MaxInFlight))
+	}
+	return opts, nil
+}
+
+func (c *ConsumerConfig) options() ([]Option, error) {
+	var opts []Option
+	switch c.InitialOffset {
+	case "":
+	case "newest":
+		opts = append(opts, WithInitialOffset(sarama.OffsetNewest))
+	case "oldest":
+		opts = append(opts, WithInitialOffset(sarama.OffsetOldest))
+	default:
+		return nil, fmt.Errorf("kafka: invalid initial_offset %q", c.InitialOffset)
+	}
+	if c.SessionTimeout > 0 {
+		opts = append(opts, WithSessionTimeout(time.Duration(c.SessionTimeout)))
+	}
+	if c.MaxProcessingTime > 0 {
+		opts = append(opts, WithMaxProcessingTime(time.Duration(c.MaxProcessingTime)))
+	}
+	if c.Concurrency > 0 {
+		opts = append(opts, WithConcurrency(c.Concurrency))
+	}
+	if c.ManualCommit {
+		opts = append(opts, WithManualCommit())
+	}
+	return opts, nil
+}
+
+// Build loads the configured CA and client cert files.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint:gosec
+	}
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("kafka: no certificate found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewProducerFromConfig builds a producer from c, options are applied after the configured ones.
+func NewProducerFromConfig(ctx context.Context, c *Config, options ...Option) (Producer, error) {
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewProducer(ctx, c.Brokers, c.SASL.Username, c.SASL.Password, append(opts, options...)...)
+}
+
+// NewAsyncProducerFromConfig builds an async producer from c, see NewProducerFromConfig.
+func NewAsyncProducerFromConfig(ctx context.Context, c *Config, options ...Option) (AsyncProducer, error) {
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewAsyncProducer(ctx, c.Brokers, c.SASL.Username, c.SASL.Password, append(opts, options...)...)
+}
+
+// NewConsumerGroupFromConfig builds a consumer group of c.Consumer.GroupID, see NewProducerFromConfig.
+func NewConsumerGroupFromConfig(ctx context.Context, c *Config, handler Handler,
+	options ...Option) (ConsumerGroup, error) {
+	if c.Consumer.GroupID == "" || len(c.Consumer.Topics) == 0 {
+		return nil, errors.New("kafka: consumer group_id and topics are required")
+	}
+	opts, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewConsumerGroup(ctx, c.Brokers, c.SASL.Username, c.SASL.Password, c.Consumer.GroupID,
+		c.Consumer.Topics, handler, append(opts, options...)...)
+}
+
+// applyNetConfig applies the options shared by the producers and consumers.
+func applyNetConfig(config *sarama.Config, username, password string, opts *Options) {
+	if username != "" {
+		config.Version = sarama.V2_3_0_0
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = username
+		config.Net.SASL.Password = password
+		mechanism := opts.saslMechanism
+		if mechanism == "" {
+			mechanism = sarama.SASLTypeSCRAMSHA512
+			if opts.useSASLPlainText {
+				mechanism = sarama.SASLTypePlaintext
+			}
+		}
+		config.Net.SASL.Mechanism = mechanism
+		switch mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &XDGSCRAMClient{HashGeneratorFcn: SHA256}
+			}
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+				return &XDGSCRAMClient{HashGeneratorFcn: SHA512}
+			}
+		}
+	}
+	if opts.version != nil {
+		config.Version = *opts.version
+	}
+	if opts.clientID != "" {
+		config.ClientID = opts.clientID
+	}
+	if opts.tlsConfig != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = opts.tlsConfig
+	}
+	if opts.dialTimeout > 0 {
+		config.Net.DialTimeout = opts.dialTimeout
+	}
+	if opts.readTimeout > 0 {
+		config.Net.ReadTimeout = opts.readTimeout
+	}
+	if opts.writeTimeout > 0 {
+		config.Net.WriteTimeout = opts.writeTimeout
+	}
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func applyConfig(t *testing.T, c *Config) *Options {
+	t.Helper()
+	options, err := c.Options()
+	assert.NoError(t, err)
+	opts := &Options{}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+func TestConfigDecodeDurations(t *testing.T) {
+	a := assert.New(t)
+	var fromJSON Config
+	a.NoError(json.Unmarshal([]byte(`{"dial_timeout":"5s","read_timeout":2000000000,`+
+		`"producer":{"linger":"100ms"},"consumer":{"session_timeout":"1m"}}`), &fromJSON))
+	a.Equal(Duration(5*time.Second), fromJSON.DialTimeout)
+	a.Equal(Duration(2*time.Second), fromJSON.ReadTimeout)
+	a.Equal(Duration(100*time.Millisecond), fromJSON.Producer.Linger)
+	a.Equal(Duration(time.Minute), fromJSON.Consumer.SessionTimeout)
+	a.Error(json.Unmarshal([]byte(`{"dial_timeout":"5 seconds"}`), &fromJSON))
+
+	var fromYAML Config
+	a.NoError(yaml.Unmarshal([]byte("dial_timeout: 5s\nproducer:\n  timeout: 3s\n"), &fromYAML))
+	a.Equal(Duration(5*time.Second), fromYAML.DialTimeout)
+	a.Equal(Duration(3*time.Second), fromYAML.Producer.Timeout)
+
+	encoded, err := json.Marshal(fromYAML)
+	a.NoError(err)
+	var decoded Config
+	a.NoError(json.Unmarshal(encoded, &decoded))
+	a.Equal(fromYAML, decoded)
+
+	opts := applyConfig(t, &fromJSON)
+	a.Equal(5*time.Second, opts.dialTimeout)
+	a.Equal(2*time.Second, opts.readTimeout)
+	a.Equal(100*time.Millisecond, opts.linger)
+	a.Equal(time.Minute, opts.sessionTimeout)
+}
+
+func TestConfigProducer(t *testing.T) {
+	a := assert.New(t)
+	acks := map[string]sarama.RequiredAcks{
+		"none":  sarama.NoResponse,
+		"local": sarama.WaitForLocal,
+		"all":   sarama.WaitForAll,
+	}
+	for name, want := range acks {
+		config := newProducerConfig("", "", applyConfig(t, &Config{Producer: ProducerConfig{RequiredAcks: name}}))
+		a.Equal(want, config.Producer.RequiredAcks, name)
+	}
+	compressions := map[string]sarama.CompressionCodec{
+		"none":   sarama.CompressionNone,
+		"gzip":   sarama.CompressionGZIP,
+		"snappy": sarama.CompressionSnappy,
+		"lz4":    sarama.CompressionLZ4,
+		"zstd":   sarama.CompressionZSTD,
+	}
+	for name, want := range compressions {
+		config := newProducerConfig("", "", applyConfig(t, &Config{Producer: ProducerConfig{Compression: name}}))
+		a.Equal(want, config.Producer.Compression, name)
+	}
+	partitioners := map[string]sarama.Partitioner{
+		"hash":        sarama.NewHashPartitioner("test"),
+		"random":      sarama.NewRandomPartitioner("test"),
+		"round_robin": sarama.NewRoundRobinPartitioner("test"),
+		"manual":      sarama.NewManualPartitioner("test"),
+	}
+	for name, want := range partitioners {
+		config := newProducerConfig("", "", applyConfig(t, &Config{Producer: ProducerConfig{Partitioner: name}}))
+		a.IsType(want, config.Producer.Partitioner("test"), name)
+	}
+
+	config := newProducerConfig("", "", applyConfig(t, &Config{
+		ClientID: "client",
+		Version:  "2.8.0",
+		Producer: ProducerConfig{
+			Timeout:    Duration(time.Second),
+			Linger:     Duration(time.Millisecond),
+			BatchSize:  10,
+			BatchBytes: 1024,
+		},
+	}))
+	a.Equal("client", config.ClientID)
+	a.Equal(sarama.V2_8_0_0, config.Version)
+	a.Equal(time.Second, config.Producer.Timeout)
+	a.Equal(time.Millisecond, config.Producer.Flush.Frequency)
+	a.Equal(10, config.Producer.Flush.Messages)
+	a.Equal(1024, config.Producer.Flush.Bytes)
+}
+
+func TestConfigConsumer(t *testing.T) {
+	a := assert.New(t)
+	offsets := map[string]int64{
+		"newest": sarama.OffsetNewest,
+		"oldest": sarama.OffsetOldest,
+	}
+	for name, want := range offsets {
+		config := newConsumerConfig("", "", applyConfig(t, &Config{Consumer: ConsumerConfig{InitialOffset: name}}))
+		a.Equal(want, config.Consumer.Offsets.Initial, name)
+	}
+
+	opts := applyConfig(t, &Config{Consumer: ConsumerConfig{
+		SessionTimeout:    Duration(20 * time.Second),
+		MaxProcessingTime: Duration(time.Second),
+		Concurrency:       4,
+		ManualCommit:      true,
+	}})
+	a.Equal(4, opts.concurrency)
+	a.True(opts.manualCommit)
+	config := newConsumerConfig("", "", opts)
+	a.Equal(20*time.Second, config.Consumer.Group.Session.Timeout)
+	a.Equal(time.Second, config.Consumer.MaxProcessingTime)
+}
+
+func TestConfigSASL(t *testing.T) {
+	a := assert.New(t)
+	mechanisms := []sarama.SASLMechanism{
+		sarama.SASLTypePlaintext,
+		sarama.SASLTypeSCRAMSHA256,
+		sarama.SASLTypeSCRAMSHA512,
+	}
+	for _, mechanism := range mechanisms {
+		c := &Config{SASL: SASLConfig{Mechanism: string(mechanism), Username: "user", Password: "password"}}
+		config := newProducerConfig(c.SASL.Username, c.SASL.Password, applyConfig(t, c))
+		a.True(config.Net.SASL.Enable)
+		a.Equal(mechanism, config.Net.SASL.Mechanism)
+		a.Equal(mechanism != sarama.SASLTypePlaintext, config.Net.SASL.SCRAMClientGeneratorFunc != nil)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	configs := map[string]*Config{
+		"version":        {Version: "latest"},
+		"sasl mechanism": {SASL: SASLConfig{Mechanism: "GSSAPI"}},
+		"required acks":  {Producer: ProducerConfig{RequiredAcks: "1"}},
+		"compression":    {Producer: ProducerConfig{Compression: "brotli"}},
+		"partitioner":    {Producer: ProducerConfig{Partitioner: "sticky"}},
+		"initial offset": {Consumer: ConsumerConfig{InitialOffset: "earliest"}},
+		"tls files":      {TLS: TLSConfig{Enable: true, CAFile: "testdata/missing.pem"}},
+	}
+	for name, c := range configs {
+		_, err := c.Options()
+		assert.Error(t, err, name)
+	}
+
+	c := &Config{Consumer: ConsumerConfig{Topics: []string{"test"}}}
+	_, err := NewConsumerGroupFromConfig(context.Background(), c, nil)
+	assert.EqualError(t, err, "kafka: consumer group_id and topics are required")
+}
@@ -21,31 +21,14 @@ type Consumer interface {
 }
 
 // NewConsumer will return a kafka consumer and you can use Process to consume messages.
+// See NewConsumerGroup to run a handler per message instead.
 func NewConsumer(ctx context.Context, brokers []string,
 	username, password, groupID string, topics []string, options ...Option) (Consumer, error) {
 	opts := &Options{}
 	for _, option := range options {
 		option(opts)
 	}
-	config := sarama.NewConfig()
-	config.Consumer.Return.Errors = true
-	config.Version = sarama.V1_0_0_0
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
-	config.Consumer.MaxProcessingTime = 2 * time.Second
-	if username != "" {
-		config.Version = sarama.V2_3_0_0
-		config.Net.SASL.Enable = true
-		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		config.Net.SASL.User = username
-		config.Net.SASL.Password = password
-		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
-			return &XDGSCRAMClient{HashGeneratorFcn: SHA512}
-		}
-		if opts.useSASLPlainText {
-			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-			config.Net.SASL.SCRAMClientGeneratorFunc = nil
-		}
-	}
+	config := newConsumerConfig(username, password, opts)
 	client, err := sarama.NewConsumerGroup(brokers, groupID, config)
 	if err != nil {
 		log.Printf("Failed to create consumer group client: err=[%v]", err)
@@ -103,13 +86,46 @@ func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 	}
 }
 
+// NewConsumerConfig returns the sarama config NewConsumerGroup builds from options,
+// for the clients which create their sarama consumer themselves.
+func NewConsumerConfig(username, password string, options ...Option) *sarama.Config {
+	opts := &Options{}
+	for _, option := range options {
+		option(opts)
+	}
+	return newConsumerConfig(username, password, opts)
+}
+
+// newConsumerConfig returns the sarama config shared by the consumers.
+func newConsumerConfig(username, password string, opts *Options) *sarama.Config {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	config.Version = sarama.V1_0_0_0
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	config.Consumer.MaxProcessingTime = 2 * time.Second
+	if len(opts.consumerInterceptors) > 0 {
+		config.Consumer.Interceptors = opts.consumerInterceptors
+	}
+	if opts.initialOffset != nil {
+		config.Consumer.Offsets.Initial = *opts.initialOffset
+	}
+	if opts.maxProcessingTime > 0 {
+		config.Consumer.MaxProcessingTime = opts.maxProcessingTime
+	}
+	if opts.sessionTimeout > 0 {
+		config.Consumer.Group.Session.Timeout = opts.sessionTimeout
+	}
+	applyNetConfig(config, username, password, opts)
+	return config
+}
+
 // consumeMessage begins to consume messages from kafka in topics.
 func (c *consumer) consumeMessage(parentCtx context.Context) {
 	ctx, cancel := context.WithCancel(parentCtx)
 	wg := &sync.WaitGroup{}
 	topics := c.topics
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
 		defer wg.Done()
 		for {
 			select {
@@ -167,3 +183,13 @@ func (m *Message) ConsumerMessage() *sarama.ConsumerMessage {
 func (m *Message) Session() sarama.ConsumerGroupSession {
 	return m.session
 }
+
+// Mark marks the message as consumed, its offset is committed by the next commit.
+func (m *Message) Mark() {
+	m.session.MarkMessage(m.consumerMessage, "")
+}
+
+// Commit commits the marked offsets synchronously, see WithManualCommit.
+func (m *Message) Commit() {
+	m.session.Commit()
+}
@@ -0,0 +1,257 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	consumeErrorBackoff    = 100 * time.Millisecond
+	consumeErrorMaxBackoff = 10 * time.Second
+)
+
+var _ sarama.ConsumerGroupHandler = (*consumerGroup)(nil)
+
+// Handler handles a message of the consumer group. In auto commit mode the message is marked
+// once Handler succeeded, see ErrorFunc for the failed ones.
+type Handler func(ctx context.Context, msg *Message) error
+
+// RebalanceFunc is called when the partitions of the consumer group are assigned or revoked,
+// session.Claims lists them.
+type RebalanceFunc func(ctx context.Context, session sarama.ConsumerGroupSession) error
+
+// ErrorFunc is called when a Handler fails or panics. Returning nil marks the message anyway,
+// e.g. once it has been sent to a dead letter topic. Returning an error, which is what happens
+// without ErrorFunc, stops marking the partition before the message: it is consumed again
+// after the next rebalance or restart, with the messages following it.
+type ErrorFunc func(ctx context.Context, msg *Message, err error) error
+
+// ConsumerGroup runs a Handler for every message of its topics.
+type ConsumerGroup interface {
+	// Run consumes until ctx is done or Close is called, rejoining the group after every rebalance.
+	// It waits for the running handlers before returning.
+	Run(ctx context.Context) error
+	Close() error
+}
+
+type consumerGroup struct {
+	client  sarama.ConsumerGroup
+	groupID string
+	topics  []string
+	handler Handler
+	opts    *Options
+}
+
+// NewConsumerGroup returns a consumer group calling handler for every message of topics.
+// Signals are left to the caller, cancel the context given to Run to stop it.
+func NewConsumerGroup(ctx context.Context, brokers []string, username, password, groupID string,
+	topics []string, handler Handler, options ...Option) (ConsumerGroup, error) {
+	opts := &Options{
+		concurrency: 1,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.concurrency <= 0 {
+		opts.concurrency = 1
+	}
+	config := newConsumerConfig(username, password, opts)
+	if opts.manualCommit {
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	}
+	client, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	if err != nil {
+		log.Printf("Failed to create consumer group client: err=[%v]", err)
+		return nil, err
+	}
+
+	//listen client's errors.
+	go func() {
+		for err := range client.Errors() {
+			log.Printf("Consumer group got errors. group=[%s], err=[%v]", groupID, err)
+		}
+	}()
+	return &consumerGroup{
+		client:  client,
+		groupID: groupID,
+		topics:  topics,
+		handler: handler,
+		opts:    opts,
+	}, nil
+}
+
+func (g *consumerGroup) Run(ctx context.Context) error {
+	consecutiveErrors := 0
+	for {
+		err := g.client.Consume(ctx, g.topics, g)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) || ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			consecutiveErrors = 0
+			continue
+		}
+		consecutiveErrors++
+		log.Printf("error occur from consumer group %s topics %s: err=[%v]", g.groupID, g.topics, err)
+		if !sleep(ctx, consumeBackoff(consecutiveErrors)) {
+			return nil
+		}
+	}
+}
+
+// consumeBackoff doubles the wait after every consecutive error, up to consumeErrorMaxBackoff.
+func consumeBackoff(consecutiveErrors int) time.Duration {
+	backoff := consumeErrorBackoff
+	for i := 1; i < consecutiveErrors && backoff < consumeErrorMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > consumeErrorMaxBackoff {
+		backoff = consumeErrorMaxBackoff
+	}
+	return backoff
+}
+
+// sleep waits for d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (g *consumerGroup) Close() error {
+	return g.client.Close()
+}
+
+func (g *consumerGroup) Setup(session sarama.ConsumerGroupSession) error {
+	if g.opts.onSetup == nil {
+		return nil
+	}
+	return g.opts.onSetup(session.Context(), session)
+}
+
+func (g *consumerGroup) Cleanup(session sarama.ConsumerGroupSession) error {
+	if g.opts.onCleanup == nil {
+		return nil
+	}
+	return g.opts.onCleanup(session.Context(), session)
+}
+
+// ConsumeClaim runs up to concurrency handlers for the messages of the claimed partition.
+func (g *consumerGroup) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	slots := make(chan struct{}, g.opts.concurrency)
+	marker := &offsetMarker{}
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil
+			}
+			msg := &Message{
+				consumerMessage: message,
+				session:         session,
+			}
+			var marked *markedMessage
+			if !g.opts.manualCommit {
+				marked = marker.add(msg)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				err := g.handle(ctx, msg)
+				if marked != nil {
+					marker.done(marked, err)
+				}
+			}()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// handle runs the handler, the returned error keeps the message from being marked.
+func (g *consumerGroup) handle(ctx context.Context, msg *Message) error {
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("kafka: handler panic: %v", r)
+			}
+		}()
+		err = g.handler(ctx, msg)
+	}()
+	if err == nil {
+		return nil
+	}
+	if g.opts.onError != nil {
+		return g.opts.onError(ctx, msg, err)
+	}
+	log.Printf("Consumer group handler failed. topic=[%s], partition=[%d], offset=[%d], err=[%v]",
+		msg.consumerMessage.Topic, msg.consumerMessage.Partition, msg.consumerMessage.Offset, err)
+	return err
+}
+
+// offsetMarker marks the messages of a partition in order: a message is marked once it
+// and every message before it succeeded, so a commit never skips a running or failed handler.
+// After a failure nothing past it is marked until the claim ends.
+type offsetMarker struct {
+	mu      sync.Mutex
+	pending []*markedMessage
+	failed  bool
+}
+
+type markedMessage struct {
+	msg    *Message
+	done   bool
+	failed bool
+}
+
+// add tracks msg, nil is returned once a message failed as msg will never be marked.
+func (m *offsetMarker) add(msg *Message) *markedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failed {
+		return nil
+	}
+	marked := &markedMessage{msg: msg}
+	m.pending = append(m.pending, marked)
+	return marked
+}
+
+// done records the result of a handler and marks the messages which succeeded in a row.
+func (m *offsetMarker) done(marked *markedMessage, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	marked.done = true
+	if err != nil {
+		marked.failed = true
+		m.failed = true
+	}
+	var last *markedMessage
+	for len(m.pending) > 0 && m.pending[0].done && !m.pending[0].failed {
+		last = m.pending[0]
+		m.pending = m.pending[1:]
+	}
+	if last != nil {
+		last.msg.Mark()
+	}
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *testSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func newTestClaim(count int) *testClaim {
+	c := &testClaim{messages: make(chan *sarama.ConsumerMessage, count)}
+	for i := 0; i < count; i++ {
+		c.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: int64(i)}
+	}
+	close(c.messages)
+	return c
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// slowFirst handles the first messages last, so they complete out of order.
+func slowFirst(count int, failed map[int64]bool) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		offset := msg.ConsumerMessage().Offset
+		time.Sleep(time.Duration(int64(count)-offset) * 5 * time.Millisecond)
+		if failed[offset] {
+			return errors.New("handler")
+		}
+		return nil
+	}
+}
+
+func TestConsumerGroupMarksInOrder(t *testing.T) {
+	a := assert.New(t)
+	session := &testSession{ctx: context.Background()}
+	g := &consumerGroup{handler: slowFirst(6, nil), opts: &Options{concurrency: 3}}
+	a.NoError(g.ConsumeClaim(session, newTestClaim(6)))
+	a.NotEmpty(session.marked)
+	a.IsIncreasing(session.marked)
+	a.Equal(int64(5), session.marked[len(session.marked)-1])
+}
+
+func TestConsumerGroupStopsMarkingAtFailure(t *testing.T) {
+	a := assert.New(t)
+	session := &testSession{ctx: context.Background()}
+	g := &consumerGroup{handler: slowFirst(6, map[int64]bool{2: true}), opts: &Options{concurrency: 3}}
+	a.NoError(g.ConsumeClaim(session, newTestClaim(6)))
+	a.NotEmpty(session.marked)
+	a.Equal(int64(1), session.marked[len(session.marked)-1])
+}
+
+func TestConsumerGroupPanicIsFailure(t *testing.T) {
+	a := assert.New(t)
+	session := &testSession{ctx: context.Background()}
+	g := &consumerGroup{
+		handler: func(ctx context.Context, msg *Message) error {
+			if msg.ConsumerMessage().Offset == 1 {
+				panic("handler")
+			}
+			return nil
+		},
+		opts: &Options{concurrency: 1},
+	}
+	a.NoError(g.ConsumeClaim(session, newTestClaim(3)))
+	a.Equal([]int64{0}, session.marked)
+}
+
+func TestConsumerGroupOnErrorHandled(t *testing.T) {
+	a := assert.New(t)
+	session := &testSession{ctx: context.Background()}
+	var handled []int64
+	g := &consumerGroup{
+		handler: slowFirst(4, map[int64]bool{1: true}),
+		opts: &Options{
+			concurrency: 2,
+			onError: func(ctx context.Context, msg *Message, err error) error {
+				handled = append(handled, msg.ConsumerMessage().Offset)
+				return nil
+			},
+		},
+	}
+	a.NoError(g.ConsumeClaim(session, newTestClaim(4)))
+	a.Equal([]int64{1}, handled)
+	a.Equal(int64(3), session.marked[len(session.marked)-1])
+}
+
+func TestConsumerGroupManualCommit(t *testing.T) {
+	a := assert.New(t)
+	session := &testSession{ctx: context.Background()}
+	g := &consumerGroup{
+		handler: func(ctx context.Context, msg *Message) error {
+			if msg.ConsumerMessage().Offset == 0 {
+				msg.Mark()
+			}
+			return nil
+		},
+		opts: &Options{concurrency: 2, manualCommit: true},
+	}
+	a.NoError(g.ConsumeClaim(session, newTestClaim(3)))
+	a.Equal([]int64{0}, session.marked)
+}
+
+type failingConsumerGroup struct {
+	sarama.ConsumerGroup
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *failingConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	return sarama.ErrOutOfBrokers
+}
+
+func TestConsumerGroupRunBackoff(t *testing.T) {
+	a := assert.New(t)
+	client := &failingConsumerGroup{}
+	g := &consumerGroup{client: client, opts: &Options{concurrency: 1}}
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	a.NoError(g.Run(ctx))
+	// 100ms then 200ms of backoff
+	a.Equal(2, client.calls)
+
+	a.Equal(consumeErrorBackoff, consumeBackoff(1))
+	a.Equal(4*consumeErrorBackoff, consumeBackoff(3))
+	a.Equal(consumeErrorMaxBackoff, consumeBackoff(100))
+}
@@ -3,6 +3,8 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"os/signal"
+	"syscall"
 )
 
 func NewConsumerExample() {
@@ -21,3 +23,21 @@ func NewConsumerExample() {
 		msg.Session().MarkMessage(msg.ConsumerMessage(), "")
 	}
 }
+
+func NewConsumerGroupExample() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	g, err := NewConsumerGroup(ctx, []string{"127.0.0.1:9092"}, "", "", "test", []string{"test"},
+		func(ctx context.Context, msg *Message) error {
+			fmt.Println(string(msg.ConsumerMessage().Value))
+			return nil
+		}, WithConcurrency(10))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer g.Close()
+	if err := g.Run(ctx); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -1,6 +1,9 @@
 package kafka
 
 import (
+	"crypto/tls"
+	"time"
+
 	"github.com/IBM/sarama"
 )
 
@@ -8,6 +11,29 @@ type Options struct {
 	useSASLPlainText     bool
 	producerInterceptors []sarama.ProducerInterceptor
 	consumerInterceptors []sarama.ConsumerInterceptor
+	linger               time.Duration
+	batchSize            int
+	batchBytes           int
+	compression          *sarama.CompressionCodec
+	requiredAcks         *sarama.RequiredAcks
+	maxInFlight          int
+	concurrency          int
+	manualCommit         bool
+	onSetup              RebalanceFunc
+	onCleanup            RebalanceFunc
+	onError              ErrorFunc
+	version              *sarama.KafkaVersion
+	clientID             string
+	tlsConfig            *tls.Config
+	saslMechanism        sarama.SASLMechanism
+	initialOffset        *int64
+	partitioner          sarama.PartitionerConstructor
+	producerTimeout      time.Duration
+	dialTimeout          time.Duration
+	readTimeout          time.Duration
+	writeTimeout         time.Duration
+	sessionTimeout       time.Duration
+	maxProcessingTime    time.Duration
 }
 
 type Option func(*Options)
@@ -32,3 +58,170 @@ func WithConsumerInterceptors(consumerInterceptors []sarama.ConsumerInterceptor)
 		o.consumerInterceptors = append(o.consumerInterceptors, consumerInterceptors...)
 	}
 }
+
+// WithLinger sets how long messages wait to be batched, the async producer sends them right away by default
+func WithLinger(linger time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.linger = linger
+	}
+}
+
+// WithBatchSize sends a batch as soon as it holds batchSize messages
+func WithBatchSize(batchSize int) func(*Options) {
+	return func(o *Options) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithBatchBytes sends a batch as soon as it holds batchBytes bytes
+func WithBatchBytes(batchBytes int) func(*Options) {
+	return func(o *Options) {
+		o.batchBytes = batchBytes
+	}
+}
+
+// WithCompression sets the compression codec of the produced batches
+func WithCompression(compression sarama.CompressionCodec) func(*Options) {
+	return func(o *Options) {
+		o.compression = &compression
+	}
+}
+
+// WithRequiredAcks sets the acks the broker must receive before a send succeeds, sarama.WaitForLocal by default
+func WithRequiredAcks(requiredAcks sarama.RequiredAcks) func(*Options) {
+	return func(o *Options) {
+		o.requiredAcks = &requiredAcks
+	}
+}
+
+// WithMaxInFlight bounds the messages the async producer has not got a result for,
+// sends block once it is reached, 1024 by default
+func WithMaxInFlight(maxInFlight int) func(*Options) {
+	return func(o *Options) {
+		o.maxInFlight = maxInFlight
+	}
+}
+
+// WithConcurrency sets how many messages of a partition the consumer group handles at once, 1 by default.
+// Offsets are still marked in order
+func WithConcurrency(concurrency int) func(*Options) {
+	return func(o *Options) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithManualCommit stops the consumer group from marking and committing offsets,
+// the handler calls Message.Mark and Message.Commit itself
+func WithManualCommit() func(*Options) {
+	return func(o *Options) {
+		o.manualCommit = true
+	}
+}
+
+// WithOnSetup is called when partitions are assigned to the consumer group, before consuming them
+func WithOnSetup(onSetup RebalanceFunc) func(*Options) {
+	return func(o *Options) {
+		o.onSetup = onSetup
+	}
+}
+
+// WithOnCleanup is called when partitions are revoked from the consumer group, after their handlers returned
+func WithOnCleanup(onCleanup RebalanceFunc) func(*Options) {
+	return func(o *Options) {
+		o.onCleanup = onCleanup
+	}
+}
+
+// WithOnError is called when the handler of the consumer group fails, see ErrorFunc,
+// by default the error is logged and the message left unmarked
+func WithOnError(onError ErrorFunc) func(*Options) {
+	return func(o *Options) {
+		o.onError = onError
+	}
+}
+
+// WithVersion sets the kafka protocol version
+func WithVersion(version sarama.KafkaVersion) func(*Options) {
+	return func(o *Options) {
+		o.version = &version
+	}
+}
+
+// WithClientID sets the client id sent to the brokers
+func WithClientID(clientID string) func(*Options) {
+	return func(o *Options) {
+		o.clientID = clientID
+	}
+}
+
+// WithTLS connects to the brokers with TLS, see TLSConfig to load client certs
+func WithTLS(tlsConfig *tls.Config) func(*Options) {
+	return func(o *Options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithSASLMechanism sets the SASL mechanism used with a username, sarama.SASLTypePlaintext,
+// sarama.SASLTypeSCRAMSHA256 or sarama.SASLTypeSCRAMSHA512 which is the default
+func WithSASLMechanism(mechanism sarama.SASLMechanism) func(*Options) {
+	return func(o *Options) {
+		o.saslMechanism = mechanism
+	}
+}
+
+// WithInitialOffset sets where a new consumer group starts, sarama.OffsetNewest by default
+func WithInitialOffset(initialOffset int64) func(*Options) {
+	return func(o *Options) {
+		o.initialOffset = &initialOffset
+	}
+}
+
+// WithPartitioner sets how the producers pick the partition of a message, by key hash by default
+func WithPartitioner(partitioner sarama.PartitionerConstructor) func(*Options) {
+	return func(o *Options) {
+		o.partitioner = partitioner
+	}
+}
+
+// WithProducerTimeout sets how long the broker waits for the required acks, 5s by default
+func WithProducerTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.producerTimeout = timeout
+	}
+}
+
+// WithDialTimeout sets the timeout of connecting to a broker
+func WithDialTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithReadTimeout sets the timeout of reading a broker response
+func WithReadTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the timeout of writing a broker request
+func WithWriteTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.writeTimeout = timeout
+	}
+}
+
+// WithSessionTimeout sets how long a consumer group member may miss heartbeats before being removed
+func WithSessionTimeout(timeout time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.sessionTimeout = timeout
+	}
+}
+
+// WithMaxProcessingTime sets how long the consumers may take to handle a message before
+// their partition is paused, 2s by default
+func WithMaxProcessingTime(maxProcessingTime time.Duration) func(*Options) {
+	return func(o *Options) {
+		o.maxProcessingTime = maxProcessingTime
+	}
+}
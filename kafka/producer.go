@@ -2,19 +2,13 @@ package kafka
 
 import (
 	"context"
-	"crypto/sha512"
 	"time"
 
 	"github.com/IBM/sarama"
-	"github.com/xdg/scram"
 )
 
 var _ Producer = (*producer)(nil)
 
-var (
-	sha512Instance scram.HashGeneratorFcn = sha512.New
-)
-
 const (
 	MaxRequestSize = 10 * 1024 * 1024
 )
@@ -35,34 +29,14 @@ type producer struct {
 	brokers  []string
 }
 
-//NewProducer Build new kafka producer
+// NewProducer Build new kafka producer
 func NewProducer(ctx context.Context, brokers []string, username, password string, options ...Option) (Producer,
 	error) {
-	kafkaConfig := sarama.NewConfig()
-	kafkaConfig.Producer.Timeout = 5 * time.Second
-	kafkaConfig.Producer.Return.Successes = true
-	kafkaConfig.Version = sarama.V2_3_0_0
 	opts := &Options{}
 	for _, option := range options {
 		option(opts)
 	}
-	if len(opts.producerInterceptors) > 0 {
-		kafkaConfig.Producer.Interceptors = opts.producerInterceptors
-	}
-	if username != "" {
-		kafkaConfig.Version = sarama.V2_3_0_0
-		kafkaConfig.Net.SASL.Enable = true
-		kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		kafkaConfig.Net.SASL.User = username
-		kafkaConfig.Net.SASL.Password = password
-		kafkaConfig.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
-			return &XDGSCRAMClient{HashGeneratorFcn: sha512Instance}
-		}
-		if opts.useSASLPlainText {
-			kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-			kafkaConfig.Net.SASL.SCRAMClientGeneratorFunc = nil
-		}
-	}
+	kafkaConfig := newProducerConfig(username, password, opts)
 	//default 100M, should <= server config
 	sarama.MaxRequestSize = MaxRequestSize
 	p, err := sarama.NewSyncProducer(brokers, kafkaConfig)
@@ -77,6 +51,50 @@ func NewProducer(ctx context.Context, brokers []string, username, password strin
 	return producerInstance, nil
 }
 
+// NewProducerConfig returns the sarama config NewProducer builds from options,
+// for the clients which create their sarama producer themselves.
+func NewProducerConfig(username, password string, options ...Option) *sarama.Config {
+	opts := &Options{}
+	for _, option := range options {
+		option(opts)
+	}
+	return newProducerConfig(username, password, opts)
+}
+
+// newProducerConfig returns the sarama config shared by the sync and async producers.
+func newProducerConfig(username, password string, opts *Options) *sarama.Config {
+	kafkaConfig := sarama.NewConfig()
+	kafkaConfig.Producer.Timeout = 5 * time.Second
+	kafkaConfig.Producer.Return.Successes = true
+	kafkaConfig.Version = sarama.V2_3_0_0
+	if len(opts.producerInterceptors) > 0 {
+		kafkaConfig.Producer.Interceptors = opts.producerInterceptors
+	}
+	if opts.linger > 0 {
+		kafkaConfig.Producer.Flush.Frequency = opts.linger
+	}
+	if opts.batchSize > 0 {
+		kafkaConfig.Producer.Flush.Messages = opts.batchSize
+	}
+	if opts.batchBytes > 0 {
+		kafkaConfig.Producer.Flush.Bytes = opts.batchBytes
+	}
+	if opts.compression != nil {
+		kafkaConfig.Producer.Compression = *opts.compression
+	}
+	if opts.requiredAcks != nil {
+		kafkaConfig.Producer.RequiredAcks = *opts.requiredAcks
+	}
+	if opts.partitioner != nil {
+		kafkaConfig.Producer.Partitioner = opts.partitioner
+	}
+	if opts.producerTimeout > 0 {
+		kafkaConfig.Producer.Timeout = opts.producerTimeout
+	}
+	applyNetConfig(kafkaConfig, username, password, opts)
+	return kafkaConfig
+}
+
 func (p *producer) SyncProduce(ctx context.Context, topic string, message []byte) (int32, int64, error) {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
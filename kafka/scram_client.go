@@ -1,11 +1,13 @@
 package kafka
 
 import (
+	"crypto/sha256"
 	"crypto/sha512"
 
 	"github.com/xdg/scram"
 )
 
+var SHA256 scram.HashGeneratorFcn = sha256.New
 var SHA512 scram.HashGeneratorFcn = sha512.New
 
 type XDGSCRAMClient struct {
@@ -0,0 +1,160 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	heldCheckInterval = 10 * time.Millisecond
+)
+
+var (
+	ErrAggregatorExactlyOnce = errors.New("kq: exactly-once does not support core.Aggregator transformers")
+)
+
+// hold is a message kept by the aggregator, it is finished once the aggregates listing it are delivered.
+// refs may go below zero when an aggregate is delivered before Process returned for the message.
+type hold struct {
+	iMessage *internalMessage
+	held     bool
+	refs     int
+
+	ctx      context.Context
+	err      error
+	attempts int
+}
+
+type holds struct {
+	mu       sync.Mutex
+	messages map[interface{}]*hold
+	held     int
+}
+
+func newHolds() *holds {
+	return &holds{messages: make(map[interface{}]*hold)}
+}
+
+// holdKey identifies a held message. Messages are matched with == when their type allows it,
+// the others, e.g. structs holding a slice, by ID since using them as a map key would panic.
+func holdKey(message core.Message) interface{} {
+	if reflect.TypeOf(message).Comparable() {
+		return message
+	}
+	return message.ID()
+}
+
+// get returns the hold of message, creating it when needed. The lock must be held.
+func (h *holds) get(message core.Message) *hold {
+	key := holdKey(message)
+	m, ok := h.messages[key]
+	if !ok {
+		m = &hold{}
+		h.messages[key] = m
+	}
+	return m
+}
+
+// count returns the number of messages kept by the aggregator.
+func (h *holds) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.held
+}
+
+// hold keeps a message the aggregator returned core.Hold for.
+func (k *KQ) hold(iMessage *internalMessage) {
+	k.holds.mu.Lock()
+	m := k.holds.get(iMessage.Message)
+	m.iMessage = iMessage
+	m.held = true
+	m.refs += iMessage.Output.Held()
+	k.holds.held++
+	done := k.releasable(iMessage.Message, m)
+	k.holds.mu.Unlock()
+	if done {
+		k.finishHold(m)
+	}
+}
+
+// release is called once an aggregate listing the message has been delivered or failed for good.
+func (k *KQ) release(message core.Message) {
+	k.holds.mu.Lock()
+	m := k.holds.get(message)
+	m.refs--
+	done := k.releasable(message, m)
+	k.holds.mu.Unlock()
+	if done {
+		k.finishHold(m)
+	}
+}
+
+// releasable forgets a hold whose aggregates have all been delivered. The lock must be held.
+func (k *KQ) releasable(message core.Message, m *hold) bool {
+	if !m.held || m.refs > 0 {
+		return false
+	}
+	delete(k.holds.messages, holdKey(message))
+	k.holds.held--
+	return true
+}
+
+// failHolds records the failure of an aggregate, its inputs go to the dead letter once released.
+func (k *KQ) failHolds(ctx context.Context, iMessage *internalMessage, err error) {
+	k.holds.mu.Lock()
+	defer k.holds.mu.Unlock()
+	for _, message := range iMessage.inputs {
+		m := k.holds.get(message)
+		if m.err == nil {
+			m.ctx, m.err, m.attempts = ctx, err, iMessage.Attempts
+		}
+	}
+}
+
+// finishHold finishes a message once the aggregates listing it are over, its OnSent functions
+// get the error of the first aggregate which failed.
+func (k *KQ) finishHold(m *hold) {
+	if m.err != nil {
+		k.sent(m.ctx, m.iMessage, m.err)
+		k.finishFailed(m.iMessage, k.sendDeadLetter(m.ctx, m.iMessage.Input, core.StageOutput, m.attempts, m.err))
+		return
+	}
+	k.sent(context.Background(), m.iMessage, nil)
+	k.finish(m.iMessage)
+}
+
+// emit queues an aggregate for the output stage. An aggregate dropped because ctx is done
+// fails its inputs, so they are not kept forever.
+func (k *KQ) emit(ctx context.Context, aggregate *core.Aggregate) {
+	iMessage := getInternalMessage()
+	iMessage.Message = aggregate.Message
+	iMessage.Output = aggregate.Output
+	iMessage.inputs = aggregate.Inputs
+	select {
+	case k.outPutMessageChanel <- iMessage:
+	case <-ctx.Done():
+		k.failHolds(ctx, iMessage, ctx.Err())
+		k.putBack(iMessage)
+	}
+}
+
+// flushAggregator waits until the aggregator keeps every in-flight message and flushes it,
+// so the drain can complete.
+func (k *KQ) flushAggregator(ctx context.Context) error {
+	ticker := time.NewTicker(heldCheckInterval)
+	defer ticker.Stop()
+	for k.offsetTracker.processing() > k.holds.count() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	k.aggregator.Flush(ctx)
+	return nil
+}
@@ -0,0 +1,273 @@
+package kq
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/deadletter/memory"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// pairAggregator emits an aggregate for every two messages whose IDs divided by 2 are equal.
+// With async set the aggregates are emitted from another goroutine, like a timer of the aggregator.
+type pairAggregator struct {
+	mu    sync.Mutex
+	emit  core.Emit
+	pairs map[int][]core.Message
+
+	async bool
+	gauge *gauge
+	emits sync.WaitGroup
+}
+
+func (p *pairAggregator) Open(ctx context.Context, emit core.Emit) {
+	p.emit = emit
+	p.pairs = make(map[int][]core.Message)
+}
+
+func (p *pairAggregator) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	id, err := strconv.Atoi(message.ID())
+	if err != nil {
+		return nil, err
+	}
+	if p.gauge != nil {
+		p.gauge.run()
+	}
+	p.mu.Lock()
+	pair := append(p.pairs[id/2], message)
+	p.pairs[id/2] = pair
+	if len(pair) == 2 {
+		delete(p.pairs, id/2)
+	}
+	p.mu.Unlock()
+	if len(pair) == 2 && p.async {
+		p.emits.Add(1)
+		go func() {
+			defer p.emits.Done()
+			p.emit(newPairAggregate(id/2, pair))
+		}()
+	} else if len(pair) == 2 {
+		p.emit(newPairAggregate(id/2, pair))
+	}
+	return core.Hold(1), nil
+}
+
+func (p *pairAggregator) Flush(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for n, pair := range p.pairs {
+		p.emit(newPairAggregate(n, pair))
+	}
+	p.pairs = make(map[int][]core.Message)
+}
+
+func (p *pairAggregator) OnDone(ctx context.Context, message core.Message) {}
+
+func (p *pairAggregator) OnError(ctx context.Context, message core.Message, err error) {}
+
+func newPairAggregate(n int, pair []core.Message) *core.Aggregate {
+	id := "pair-" + strconv.Itoa(n)
+	return &core.Aggregate{
+		Message: &testMessage{id: id, ctx: context.Background()},
+		Output:  &core.OutputMessage{Ctx: context.Background(), Data: id},
+		Inputs:  pair,
+	}
+}
+
+func TestKQAggregator(t *testing.T) {
+	for name, opt := range map[string]Option{
+		"unordered":   WithMaxGoroutines(4),
+		"key-ordered": WithKeyOrdered(2),
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			input := newTestInput(1, 5)
+			output := &flakyOutput{failures: map[interface{}]int{"pair-1": 1}, err: errTransient}
+			deadLetter := memory.NewDeadLetter()
+			k := newTestKQ(ctx, input, &pairAggregator{}, output, opt).SetDeadLetter(ctx, deadLetter)
+			a.NoError(k.Run(ctx))
+			for output.count()+len(deadLetter.Messages()) < 3 {
+				time.Sleep(time.Millisecond)
+			}
+			a.Eventually(func() bool {
+				return k.Stats().Completed == 4
+			}, time.Second, time.Millisecond, "the unpaired message stays held")
+			input.mu.Lock()
+			a.Equal(int64(3), input.committed[0])
+			input.mu.Unlock()
+
+			closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			a.NoError(k.Close(closeCtx))
+			a.ElementsMatch([]interface{}{"pair-0", "pair-2"}, output.received)
+			var failed []string
+			for _, m := range deadLetter.Messages() {
+				a.Equal(core.StageOutput, m.Stage)
+				a.ErrorIs(m.Err, errTransient)
+				failed = append(failed, string(m.Raw.Value))
+			}
+			a.ElementsMatch([]string{"2", "3"}, failed)
+			a.Equal(uint64(5), k.Stats().Completed)
+			a.Equal(int64(4), input.committed[0])
+		})
+	}
+}
+
+func TestKQAggregatorExactlyOnce(t *testing.T) {
+	ctx := context.Background()
+	k := newTestKQ(ctx, newTestInput(1, 0), &pairAggregator{}, &testOutput{},
+		WithExactlyOnce(TransactionOptions{}))
+	assert.ErrorIs(t, k.Run(ctx), ErrAggregatorExactlyOnce)
+}
+
+// windowAggregator holds every message until Flush, like a window longer than the test.
+type windowAggregator struct {
+	mu       sync.Mutex
+	emit     core.Emit
+	messages []core.Message
+}
+
+func (w *windowAggregator) Open(ctx context.Context, emit core.Emit) {
+	w.emit = emit
+}
+
+func (w *windowAggregator) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, message)
+	return core.Hold(1), nil
+}
+
+func (w *windowAggregator) Flush(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.emit(&core.Aggregate{
+		Message: &testMessage{id: "window", ctx: context.Background()},
+		Output:  &core.OutputMessage{Ctx: context.Background(), Data: len(w.messages)},
+		Inputs:  w.messages,
+	})
+	w.messages = nil
+}
+
+func (w *windowAggregator) OnDone(ctx context.Context, message core.Message) {}
+
+func (w *windowAggregator) OnError(ctx context.Context, message core.Message, err error) {}
+
+func TestKQAggregatorBackpressure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := &pausableInput{testInput: newTestInput(1, 20)}
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &windowAggregator{}, output,
+		WithBackpressure(BackpressureOptions{HighInFlight: 4, CheckInterval: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	a.Eventually(func() bool {
+		return k.Stats().Consumed == 20
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	a.Equal(20, k.Stats().InFlight)
+	a.False(k.Paused(), "held messages do not count as in flight")
+
+	closeCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	a.NoError(k.Close(closeCtx))
+	a.Equal([]interface{}{20}, output.received)
+}
+
+// sliceMessage cannot be compared with ==, kq must not use it as a map key.
+type sliceMessage []string
+
+func (m sliceMessage) ID() string           { return m[0] }
+func (m sliceMessage) Timestamp() time.Time { return time.Time{} }
+func (m sliceMessage) Ctx() context.Context { return context.Background() }
+
+func TestKQHoldNotComparable(t *testing.T) {
+	a := assert.New(t)
+	k := NewKQ(context.Background())
+	input := core.NewInputMessage()
+	iMessage := getInternalMessage()
+	iMessage.Input = input
+	iMessage.Message = sliceMessage{"1"}
+	iMessage.Output = core.Hold(1)
+	k.hold(iMessage)
+	a.Equal(1, k.holds.count())
+
+	k.release(sliceMessage{"1"})
+	a.Equal(0, k.holds.count())
+	a.True(input.Acked())
+}
+
+// gauge records the highest number of concurrent runs.
+type gauge struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (g *gauge) run() {
+	g.mu.Lock()
+	g.running++
+	if g.running > g.max {
+		g.max = g.running
+	}
+	g.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	g.mu.Lock()
+	g.running--
+	g.mu.Unlock()
+}
+
+type gaugeOutput struct {
+	testOutput
+	gauge *gauge
+}
+
+func (o *gaugeOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	o.gauge.run()
+	return o.testOutput.SendOutput(ctx, message)
+}
+
+func TestKQAggregatorKeyOrderedLimit(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	g := &gauge{}
+	aggregator := &pairAggregator{async: true, gauge: g}
+	output := &gaugeOutput{gauge: g}
+	k := newTestKQ(ctx, newTestInput(1, 20), aggregator, output, WithKeyOrdered(4), WithMaxGoroutines(1))
+	a.NoError(k.Run(ctx))
+	for output.count() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	aggregator.emits.Wait()
+	a.Equal(1, g.max, "aggregates are sent within the goroutine limit")
+	a.Equal(uint64(20), k.Stats().Completed)
+}
+
+func TestKQEmitCanceled(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	k := newTestKQ(ctx, newTestInput(1, 0), &pairAggregator{}, &testOutput{}, WithOutPutMessageChannelSize(0))
+	inputMessage := core.NewInputMessage()
+	inputMessage.Raw = &sarama.ConsumerMessage{Topic: "test"}
+	message := &testMessage{id: "0", ctx: ctx}
+	iMessage := getInternalMessage()
+	iMessage.Input = inputMessage
+	iMessage.Message = message
+	iMessage.Output = core.Hold(1)
+	k.hold(iMessage)
+	a.Equal(1, k.holds.count())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	k.emit(canceled, newPairAggregate(0, []core.Message{message}))
+	a.Equal(0, k.holds.count(), "the inputs of a dropped aggregate are released")
+	a.True(inputMessage.Acked())
+}
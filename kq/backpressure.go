@@ -0,0 +1,154 @@
+package kq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	defaultBackpressureCheckInterval = 100 * time.Millisecond
+)
+
+// BackpressureOptions pauses the input while the pipeline is saturated and resumes it once drained.
+type BackpressureOptions struct {
+	// HighInFlight pauses the input once that many messages are consumed but not acked, 0 disables it.
+	// Messages kept by a core.Aggregator are not counted, they wait for their window rather than
+	// for the pipeline.
+	HighInFlight int `yaml:"high_in_flight" json:"high_in_flight"`
+	// LowInFlight resumes the input once the in-flight messages drop to it, defaults to HighInFlight / 2.
+	LowInFlight int `yaml:"low_in_flight" json:"low_in_flight"`
+	// HighLatency pauses the input once the recent latency of any stage reaches it, 0 disables it.
+	HighLatency time.Duration `yaml:"high_latency" json:"high_latency"`
+	// CheckInterval is how often the watermarks are checked, defaults to 100ms.
+	CheckInterval time.Duration `yaml:"check_interval" json:"check_interval"`
+}
+
+// pauseGate tracks whether the input is paused by an operator or by backpressure,
+// open is closed while neither holds it.
+type pauseGate struct {
+	mu     sync.Mutex
+	manual bool
+	auto   bool
+	open   chan struct{}
+}
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{open: make(chan struct{})}
+	close(g.open)
+	return g
+}
+
+// set updates the non nil flags and calls apply under the lock when the gate changes,
+// so the input sees pause and resume in order.
+func (g *pauseGate) set(manual, auto *bool, apply func(paused bool)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	before := g.manual || g.auto
+	if manual != nil {
+		g.manual = *manual
+	}
+	if auto != nil {
+		g.auto = *auto
+	}
+	after := g.manual || g.auto
+	if before == after {
+		return
+	}
+	if after {
+		g.open = make(chan struct{})
+	} else {
+		close(g.open)
+	}
+	apply(after)
+}
+
+func (g *pauseGate) wait() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.open
+}
+
+func (g *pauseGate) state() (manual, auto bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.manual, g.auto
+}
+
+// Pause stops pulling from the input until Resume is called, messages already consumed keep flowing.
+func (k *KQ) Pause(ctx context.Context) {
+	paused := true
+	k.pause.set(&paused, nil, k.applyPause(ctx))
+}
+
+// Resume undoes Pause, the input stays paused while backpressure holds it.
+func (k *KQ) Resume(ctx context.Context) {
+	paused := false
+	k.pause.set(&paused, nil, k.applyPause(ctx))
+}
+
+// Paused reports whether the input is paused by Pause or by backpressure.
+func (k *KQ) Paused() bool {
+	manual, auto := k.pause.state()
+	return manual || auto
+}
+
+func (k *KQ) applyPause(ctx context.Context) func(paused bool) {
+	return func(paused bool) {
+		pausable, ok := k.input.(core.Pausable)
+		if !ok {
+			return
+		}
+		var err error
+		if paused {
+			err = pausable.Pause(ctx)
+		} else {
+			err = pausable.Resume(ctx)
+		}
+		if err != nil {
+			fmt.Printf("kq pause input. paused=[%v], err=[%v]\n", paused, err)
+		}
+	}
+}
+
+func (k *KQ) backpressure(ctx context.Context) error {
+	ticker := time.NewTicker(k.backpressureOptions.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			_, auto := k.pause.state()
+			saturated := k.saturated(auto)
+			k.pause.set(nil, &saturated, k.applyPause(ctx))
+		}
+	}
+}
+
+// saturated checks the watermarks, once paused the input stays paused until the in-flight
+// messages drop to the low watermark since a paused pipeline observes no new latencies.
+func (k *KQ) saturated(paused bool) bool {
+	o := k.backpressureOptions
+	inFlight := k.offsetTracker.processing() - k.holds.count()
+	if paused {
+		return inFlight > o.LowInFlight
+	}
+	if o.HighInFlight > 0 && inFlight >= o.HighInFlight {
+		return true
+	}
+	return o.HighLatency > 0 && inFlight > o.LowInFlight && k.recentLatency() >= o.HighLatency
+}
+
+func (k *KQ) recentLatency() time.Duration {
+	var latency int64
+	for _, s := range k.stageStats {
+		if recent := s.recentLatency.Load(); recent > latency {
+			latency = recent
+		}
+	}
+	return time.Duration(latency)
+}
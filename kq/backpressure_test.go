@@ -0,0 +1,117 @@
+package kq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pausableInput struct {
+	*testInput
+
+	pauseMu sync.Mutex
+	pauses  []bool
+}
+
+func (in *pausableInput) Pause(ctx context.Context) error {
+	in.pauseMu.Lock()
+	defer in.pauseMu.Unlock()
+	in.pauses = append(in.pauses, true)
+	return nil
+}
+
+func (in *pausableInput) Resume(ctx context.Context) error {
+	in.pauseMu.Lock()
+	defer in.pauseMu.Unlock()
+	in.pauses = append(in.pauses, false)
+	return nil
+}
+
+func (in *pausableInput) pauseCalls() []bool {
+	in.pauseMu.Lock()
+	defer in.pauseMu.Unlock()
+	return append([]bool(nil), in.pauses...)
+}
+
+type blockingOutput struct {
+	testOutput
+	release chan struct{}
+}
+
+func (o *blockingOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	<-o.release
+	return o.testOutput.SendOutput(ctx, message)
+}
+
+func TestKQPauseResume(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := &pausableInput{testInput: newTestInput(1, 10)}
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output)
+	k.Pause(ctx)
+	a.True(k.Paused())
+	a.NoError(k.Run(ctx))
+	time.Sleep(20 * time.Millisecond)
+	a.Equal(uint64(0), k.Stats().Consumed)
+	a.True(k.Stats().Paused)
+
+	k.Resume(ctx)
+	a.False(k.Paused())
+	for output.count() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	a.Equal([]bool{true, false}, input.pauseCalls())
+}
+
+func TestKQBackpressure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := &pausableInput{testInput: newTestInput(2, 100)}
+	output := &blockingOutput{release: make(chan struct{})}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithBackpressure(BackpressureOptions{HighInFlight: 10, LowInFlight: 2, CheckInterval: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for !k.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+	a.GreaterOrEqual(k.Stats().InFlight, 10)
+
+	close(output.release)
+	for output.count() < 100 {
+		time.Sleep(time.Millisecond)
+	}
+	for k.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	calls := input.pauseCalls()
+	a.GreaterOrEqual(len(calls), 2)
+	a.Equal(true, calls[0])
+	a.Equal(false, calls[len(calls)-1])
+}
+
+func TestKQSaturated(t *testing.T) {
+	a := assert.New(t)
+	k := NewKQ(context.Background(),
+		WithBackpressure(BackpressureOptions{HighInFlight: 4, HighLatency: time.Second}))
+	a.Equal(2, k.backpressureOptions.LowInFlight)
+	for i := 0; i < 3; i++ {
+		k.offsetTracker.track(newTestInputMessage("test", 0, int64(i)))
+	}
+	a.False(k.saturated(false))
+	a.True(k.saturated(true))
+
+	k.stageStats[core.StageOutput].recentLatency.Store(int64(2 * time.Second))
+	a.True(k.saturated(false))
+
+	k.offsetTracker.track(newTestInputMessage("test", 0, 3))
+	k.stageStats[core.StageOutput].recentLatency.Store(0)
+	a.True(k.saturated(false))
+}
@@ -0,0 +1,133 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goSafe "github.com/colinrs/pkgx/fx"
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	defaultBatchMaxSize = 100
+	defaultBatchLinger  = 100 * time.Millisecond
+)
+
+// BatchOptions decides when the messages waiting for a core.BatchOutput are sent,
+// a batch is sent as soon as one of the limits is reached.
+type BatchOptions struct {
+	// MaxSize is the maximum number of messages in a batch, 100 by default.
+	MaxSize int `yaml:"max_size" json:"max_size"`
+	// MaxBytes is the maximum sum of SizeOf over a batch, 0 means no limit.
+	MaxBytes int `yaml:"max_bytes" json:"max_bytes"`
+	// Linger is how long the first message of a batch may wait, 100ms by default.
+	Linger time.Duration `yaml:"linger" json:"linger"`
+	// SizeOf returns the size of a message, by default the length of []byte and string data.
+	SizeOf func(message *core.OutputMessage) int `yaml:"-" json:"-"`
+}
+
+func (o *BatchOptions) sizeOf(message *core.OutputMessage) int {
+	if o.SizeOf != nil {
+		return o.SizeOf(message)
+	}
+	switch data := message.Data.(type) {
+	case []byte:
+		return len(data)
+	case string:
+		return len(data)
+	default:
+		return 0
+	}
+}
+
+// batchMessage groups the messages which went through the output middlewares
+// and sends every batch from its own goroutine, one batch at a time in key-ordered mode.
+func (k *KQ) batchMessage(ctx context.Context) error {
+	var (
+		batch []*internalMessage
+		bytes int
+	)
+	linger := time.NewTimer(k.batchOptions.Linger)
+	linger.Stop()
+	flush := func() {
+		linger.Stop()
+		if len(batch) == 0 {
+			return
+		}
+		messages := batch
+		batch, bytes = nil, 0
+		// the shared limit is not used: its slots may all be held by sends waiting for this loop
+		k.batchLimit.Acquire()
+		goSafe.GoSafeWithRecover(func() {
+			k.sendBatch(ctx, messages)
+		}, kqRecover(batchMessageEventName, func() {
+			k.batchLimit.Release()
+		}))
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case iMessage := <-k.batchChannel:
+			if len(batch) == 0 {
+				linger.Reset(k.batchOptions.Linger)
+			}
+			batch = append(batch, iMessage)
+			for _, output := range iMessage.Output.Outputs() {
+				bytes += k.batchOptions.sizeOf(output)
+			}
+			if len(batch) >= k.batchOptions.MaxSize ||
+				(k.batchOptions.MaxBytes > 0 && bytes >= k.batchOptions.MaxBytes) {
+				flush()
+			}
+		case <-linger.C:
+			flush()
+		}
+	}
+}
+
+// sendBatch sends a batch and acks its messages once it succeeded or was given up,
+// the children of a message are always sent in the same batch.
+// After a core.PartialError only the failed messages are sent again.
+func (k *KQ) sendBatch(ctx context.Context, batch []*internalMessage) {
+	pending := make([]*core.OutputMessage, 0, len(batch))
+	for _, iMessage := range batch {
+		pending = append(pending, iMessage.Output.Outputs()...)
+	}
+	start := time.Now()
+	attempts, err := retry(ctx, k.outputRetryPolicy, func() error {
+		err := k.batchOutput.SendOutputs(ctx, pending)
+		var partialErr *core.PartialError
+		switch {
+		case err == nil:
+			pending = nil
+		case errors.As(err, &partialErr) && len(partialErr.Failed) > 0:
+			pending = partialErr.Failed
+		}
+		return err
+	}, noop, noop)
+	k.observeStage(batchStageName, time.Since(start), err)
+	failed := make(map[*core.OutputMessage]bool, len(pending))
+	for _, output := range pending {
+		failed[output] = true
+	}
+	for _, iMessage := range batch {
+		if err != nil && hasFailed(iMessage, failed) {
+			iMessage.Attempts = attempts
+			k.finishFailed(iMessage, k.outputError(ctx, iMessage, err))
+			continue
+		}
+		k.outputDone(ctx, iMessage)
+		k.finish(iMessage)
+	}
+}
+
+func hasFailed(iMessage *internalMessage, failed map[*core.OutputMessage]bool) bool {
+	for _, output := range iMessage.Output.Outputs() {
+		if failed[output] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/deadletter/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBatchOutput struct {
+	testOutput
+	batchMu sync.Mutex
+	batches []int
+	err     error
+}
+
+func (o *testBatchOutput) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	if o.err != nil {
+		return o.err
+	}
+	o.batchMu.Lock()
+	o.batches = append(o.batches, len(messages))
+	o.batchMu.Unlock()
+	for _, m := range messages {
+		_ = o.testOutput.SendOutput(ctx, m)
+	}
+	return nil
+}
+
+func TestKQBatch(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 25)
+	output := &testBatchOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithBatch(BatchOptions{MaxSize: 10, Linger: 20 * time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for output.count() < 25 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	total := 0
+	for _, size := range output.batches {
+		a.LessOrEqual(size, 10)
+		total += size
+	}
+	a.Equal(25, total)
+	a.GreaterOrEqual(len(output.batches), 3)
+	a.Equal(int64(24), input.committed[0])
+}
+
+func TestKQBatchFailure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	batchErr := errors.New("bulk")
+	input := newTestInput(1, 4)
+	deadLetter := memory.NewDeadLetter()
+	k := newTestKQ(ctx, input, &testTransformer{}, &testBatchOutput{err: batchErr},
+		WithBatch(BatchOptions{MaxBytes: 2})).
+		SetDeadLetter(ctx, deadLetter)
+	a.NoError(k.Run(ctx))
+	for len(deadLetter.Messages()) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	a.Equal(int64(3), input.committed[0])
+}
+
+// partialBatchOutput fails every odd message the first time it is sent.
+type partialBatchOutput struct {
+	testOutput
+	sendsMu sync.Mutex
+	sends   map[string]int
+	delay   func(batch int) time.Duration
+	batch   int
+}
+
+func (o *partialBatchOutput) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	o.sendsMu.Lock()
+	o.batch++
+	batch := o.batch
+	o.sendsMu.Unlock()
+	if o.delay != nil {
+		time.Sleep(o.delay(batch))
+	}
+	var failed []*core.OutputMessage
+	for _, m := range messages {
+		id := m.Data.(string)
+		o.sendsMu.Lock()
+		o.sends[id]++
+		first := o.sends[id] == 1
+		o.sendsMu.Unlock()
+		if first && id[len(id)-1]%2 == 1 {
+			failed = append(failed, m)
+			continue
+		}
+		_ = o.testOutput.SendOutput(ctx, m)
+	}
+	if len(failed) > 0 {
+		return &core.PartialError{Failed: failed, Err: errors.New("partial")}
+	}
+	return nil
+}
+
+func TestKQBatchPartialFailure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 10)
+	output := &partialBatchOutput{sends: make(map[string]int)}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithBatch(BatchOptions{MaxSize: 10, Linger: 10 * time.Millisecond}),
+		WithOutputRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for output.count() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	for id, sends := range output.sends {
+		if id[len(id)-1]%2 == 1 {
+			a.Equal(2, sends, id)
+		} else {
+			a.Equal(1, sends, id)
+		}
+	}
+	a.Equal(int64(9), input.committed[0])
+}
+
+func TestKQBatchKeyOrdered(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 30)
+	output := &partialBatchOutput{
+		sends: make(map[string]int),
+		// the first batches are the slowest, concurrent batches would overtake them
+		delay: func(batch int) time.Duration {
+			return time.Duration(30-batch) * time.Millisecond
+		},
+	}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithKeyOrdered(3),
+		WithKeyFunc(func(message core.Message) string { return message.ID()[len(message.ID())-1:] }),
+		WithBatch(BatchOptions{MaxSize: 2, Linger: time.Millisecond}),
+		WithOutputRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for output.count() < 30 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	last := make(map[string]int)
+	for _, data := range output.received {
+		var n int
+		_, _ = fmt.Sscan(data.(string), &n)
+		key := data.(string)[len(data.(string))-1:]
+		if previous, ok := last[key]; ok {
+			a.Greater(n, previous, "key %s", key)
+		}
+		last[key] = n
+	}
+}
+
+func TestKQBatchSingleGoroutine(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 50)
+	output := &testBatchOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithMaxGoroutines(1),
+		WithBatch(BatchOptions{MaxSize: 2, Linger: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for output.count() < 50 && closeCtx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(closeCtx))
+	a.Equal(int64(49), input.committed[0])
+}
@@ -0,0 +1,290 @@
+package kq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/zeromicro/go-zero/core/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownPlugin = errors.New("kq: unknown plugin")
+	ErrMissingPlugin = errors.New("kq: missing plugin")
+)
+
+// Config describes a pipeline, see NewFromConfig. Outputs and AckPolicy replace Output
+// to send every message to several outputs, see KQ.SetOutputs. For example:
+//
+//	input:
+//	  type: kafka
+//	  config:
+//	    brokers: [localhost:9092]
+//	    group_id: orders
+//	    topics: [orders]
+//	extractor:
+//	  type: json
+//	  config:
+//	    id_field: id
+//	transformer:
+//	  type: enrich-orders
+//	output:
+//	  type: kafka
+//	  config:
+//	    brokers: [localhost:9092]
+//	    topic: orders-enriched
+//	dead_letter:
+//	  type: kafka
+//	  config:
+//	    brokers: [localhost:9092]
+//	    topic: orders-dlq
+//	options:
+//	  max_goroutines: 100
+//	  output_retry:
+//	    max_attempts: 3
+//	    initial_backoff: 100ms
+type Config struct {
+	Input       PluginConfig   `yaml:"input" json:"input"`
+	Extractor   PluginConfig   `yaml:"extractor" json:"extractor"`
+	Transformer PluginConfig   `yaml:"transformer" json:"transformer"`
+	Output      PluginConfig   `yaml:"output" json:"output"`
+	Outputs     []PluginConfig `yaml:"outputs" json:"outputs"`
+	AckPolicy   AckPolicy      `yaml:"ack_policy" json:"ack_policy"`
+	DeadLetter  *PluginConfig  `yaml:"dead_letter" json:"dead_letter"`
+	Options     OptionsConfig  `yaml:"options" json:"options"`
+}
+
+// PluginConfig names a registered plugin, Config is decoded by its factory.
+type PluginConfig struct {
+	Type   string    `yaml:"type" json:"type"`
+	Config yaml.Node `yaml:"config" json:"config"`
+}
+
+// Decode implements core.PluginConfig, unknown fields are rejected and a missing config leaves v untouched.
+func (c *PluginConfig) Decode(v interface{}) error {
+	if c.Config.Kind == 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(&c.Config)
+	if err == nil {
+		err = decodeStrict(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("kq: decode %s config: %w", c.Type, err)
+	}
+	return nil
+}
+
+// OptionsConfig holds the Option values of a configured pipeline, zero values keep the defaults.
+type OptionsConfig struct {
+	InputMessageChannelSize     int                  `yaml:"input_message_channel_size" json:"input_message_channel_size"`
+	MaxGoroutines               int                  `yaml:"max_goroutines" json:"max_goroutines"`
+	ExtractorMessageChannelSize int                  `yaml:"extractor_message_channel_size" json:"extractor_message_channel_size"`
+	OutPutMessageChannelSize    int                  `yaml:"output_message_channel_size" json:"output_message_channel_size"`
+	KeyOrdered                  int                  `yaml:"key_ordered" json:"key_ordered"`
+	TransformerRetry            *RetryPolicy         `yaml:"transformer_retry" json:"transformer_retry"`
+	OutputRetry                 *RetryPolicy         `yaml:"output_retry" json:"output_retry"`
+	Batch                       *BatchOptions        `yaml:"batch" json:"batch"`
+	Backpressure                *BackpressureOptions `yaml:"backpressure" json:"backpressure"`
+	ExactlyOnce                 *TransactionOptions  `yaml:"exactly_once" json:"exactly_once"`
+}
+
+// Options returns the Option list matching the configured values.
+func (c OptionsConfig) Options() []Option {
+	var opts []Option
+	if c.InputMessageChannelSize > 0 {
+		opts = append(opts, WithInputMessageChannelSize(c.InputMessageChannelSize))
+	}
+	if c.MaxGoroutines > 0 {
+		opts = append(opts, WithMaxGoroutines(c.MaxGoroutines))
+	}
+	if c.ExtractorMessageChannelSize > 0 {
+		opts = append(opts, WithExtractorMessageChannelSize(c.ExtractorMessageChannelSize))
+	}
+	if c.OutPutMessageChannelSize > 0 {
+		opts = append(opts, WithOutPutMessageChannelSize(c.OutPutMessageChannelSize))
+	}
+	if c.KeyOrdered > 0 {
+		opts = append(opts, WithKeyOrdered(c.KeyOrdered))
+	}
+	if c.TransformerRetry != nil {
+		opts = append(opts, WithTransformerRetryPolicy(*c.TransformerRetry))
+	}
+	if c.OutputRetry != nil {
+		opts = append(opts, WithOutputRetryPolicy(*c.OutputRetry))
+	}
+	if c.Batch != nil {
+		opts = append(opts, WithBatch(*c.Batch))
+	}
+	if c.Backpressure != nil {
+		opts = append(opts, WithBackpressure(*c.Backpressure))
+	}
+	if c.ExactlyOnce != nil {
+		opts = append(opts, WithExactlyOnce(*c.ExactlyOnce))
+	}
+	return opts
+}
+
+// LoadConfig parses a YAML or JSON document, unknown fields are rejected.
+func LoadConfig(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := decodeStrict(data, c); err != nil {
+		return nil, fmt.Errorf("kq: load config: %w", err)
+	}
+	return c, nil
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// LoadConfigFile parses the YAML or JSON file at path, see LoadConfig.
+func LoadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadConfig(data)
+}
+
+// NewFromConfig builds a pipeline from a YAML or JSON document, see Config.
+// The plugins are looked up in the core registry, so the packages providing them must be imported,
+// and opts are applied before the configured options.
+func NewFromConfig(ctx context.Context, data []byte, opts ...Option) (*KQ, error) {
+	c, err := LoadConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.Build(ctx, opts...)
+}
+
+// NewFromConfigFile builds a pipeline from the YAML or JSON file at path, see NewFromConfig.
+func NewFromConfigFile(ctx context.Context, path string, opts ...Option) (*KQ, error) {
+	c, err := LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Build(ctx, opts...)
+}
+
+// Build creates the configured plugins and returns the pipeline, ready to Run.
+// The plugins already created are closed when a later one fails.
+func (c *Config) Build(ctx context.Context, opts ...Option) (k *KQ, err error) {
+	var closers []func(ctx context.Context) error
+	defer func() {
+		if err == nil {
+			return
+		}
+		var batchErr errorx.BatchError
+		batchErr.Add(err)
+		for _, closer := range closers {
+			batchErr.Add(closer(ctx))
+		}
+		err = batchErr.Err()
+	}()
+
+	if err = c.check(); err != nil {
+		return nil, err
+	}
+	input, err := buildPlugin(ctx, "input", &c.Input, core.LookupInput)
+	if err != nil {
+		return nil, err
+	}
+	closers = append(closers, input.Close)
+	extractor, err := buildPlugin(ctx, "extractor", &c.Extractor, core.LookupExtractor)
+	if err != nil {
+		return nil, err
+	}
+	transformer, err := buildPlugin(ctx, "transformer", &c.Transformer, core.LookupTransformer)
+	if err != nil {
+		return nil, err
+	}
+	var output core.Output
+	if len(c.Outputs) == 0 {
+		if output, err = buildPlugin(ctx, "output", &c.Output, core.LookupOutput); err != nil {
+			return nil, err
+		}
+		closers = append(closers, output.Close)
+	} else {
+		outputs := make([]core.Output, 0, len(c.Outputs))
+		for i := range c.Outputs {
+			o, err := buildPlugin(ctx, "output", &c.Outputs[i], core.LookupOutput)
+			if err != nil {
+				return nil, err
+			}
+			closers = append(closers, o.Close)
+			outputs = append(outputs, o)
+		}
+		policy := c.AckPolicy
+		if policy == "" {
+			policy = AckAll
+		}
+		output = NewMultiOutput(policy, outputs...)
+	}
+	var deadLetter core.DeadLetter
+	if c.DeadLetter != nil {
+		if deadLetter, err = buildPlugin(ctx, "dead_letter", c.DeadLetter, core.LookupDeadLetter); err != nil {
+			return nil, err
+		}
+	}
+
+	k = NewKQ(ctx, WithOptions(opts...), WithOptions(c.Options.Options()...)).
+		SetInput(ctx, input).
+		SetExtractor(ctx, extractor).
+		SetTransformer(ctx, transformer).
+		SetOutput(ctx, output)
+	if deadLetter != nil {
+		k.SetDeadLetter(ctx, deadLetter)
+	}
+	return k, nil
+}
+
+func (c *Config) check() error {
+	for _, plugin := range []struct {
+		kind   string
+		config *PluginConfig
+	}{
+		{"input", &c.Input},
+		{"extractor", &c.Extractor},
+		{"transformer", &c.Transformer},
+	} {
+		if plugin.config.Type == "" {
+			return fmt.Errorf("%w: %s", ErrMissingPlugin, plugin.kind)
+		}
+	}
+	switch {
+	case len(c.Outputs) > 0 && c.Output.Type != "":
+		return errors.New("kq: output and outputs are exclusive")
+	case len(c.Outputs) == 0 && c.Output.Type == "":
+		return fmt.Errorf("%w: output", ErrMissingPlugin)
+	case c.AckPolicy != "" && !c.AckPolicy.valid():
+		return fmt.Errorf("kq: unknown ack policy %q", c.AckPolicy)
+	}
+	return nil
+}
+
+func buildPlugin[T any, F ~func(ctx context.Context, config core.PluginConfig) (T, error)](ctx context.Context,
+	kind string, c *PluginConfig, lookup func(name string) (F, bool)) (T, error) {
+	factory, ok := lookup(c.Type)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: %s %q", ErrUnknownPlugin, kind, c.Type)
+	}
+	plugin, err := factory(ctx, c)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("kq: build %s %q: %w", kind, c.Type, err)
+	}
+	return plugin, nil
+}
@@ -0,0 +1,138 @@
+package kq
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	kqjson "github.com/colinrs/pkgx/kq/plugin/extractor/json"
+	_ "github.com/colinrs/pkgx/kq/plugin/input/file"
+	_ "github.com/colinrs/pkgx/kq/plugin/output/file"
+	"github.com/colinrs/pkgx/kq/plugin/transformer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	core.RegisterTransformer("config-test-name", func(ctx context.Context,
+		config core.PluginConfig) (core.Transformer, error) {
+		c := &struct {
+			Prefix string `yaml:"prefix"`
+		}{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		return transformer.Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+			value, _ := kqjson.Value[map[string]interface{}](message)
+			return c.Prefix + value["name"].(string), nil
+		}), nil
+	})
+}
+
+const configTestYAML = `
+input:
+  type: file
+  config:
+    path: {{input}}
+    topic: users
+extractor:
+  type: json
+  config:
+    id_field: id
+transformer:
+  type: config-test-name
+  config:
+    prefix: "name="
+output:
+  type: file
+  config:
+    path: {{output}}
+options:
+  max_goroutines: 2
+  output_message_channel_size: 10
+  output_retry:
+    max_attempts: 3
+    initial_backoff: 10ms
+`
+
+const configTestJSON = `{
+  "input": {"type": "file", "config": {"path": "{{input}}", "topic": "users"}},
+  "extractor": {"type": "json", "config": {"id_field": "id"}},
+  "transformer": {"type": "config-test-name", "config": {"prefix": "name="}},
+  "output": {"type": "file", "config": {"path": "{{output}}"}},
+  "options": {
+    "max_goroutines": 2,
+    "output_message_channel_size": 10,
+    "output_retry": {"max_attempts": 3, "initial_backoff": "10ms"}
+  }
+}`
+
+func TestNewFromConfig(t *testing.T) {
+	for name, document := range map[string]string{"yaml": configTestYAML, "json": configTestJSON} {
+		t.Run(name, func(t *testing.T) {
+			a := assert.New(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			dir := t.TempDir()
+			input, output := filepath.Join(dir, "input"), filepath.Join(dir, "output")
+			a.NoError(os.WriteFile(input, []byte(`{"id":1,"name":"a"}`+"\n"+`{"id":2,"name":"b"}`+"\n"), 0o644))
+			document = strings.NewReplacer("{{input}}", input, "{{output}}", output).Replace(document)
+
+			k, err := NewFromConfig(ctx, []byte(document), WithMaxGoroutines(100))
+			a.NoError(err)
+			a.Equal(2, k.maxGoroutines, "the configured options override opts")
+			a.Equal(10, cap(k.outPutMessageChanel))
+			a.Equal(3, k.outputRetryPolicy.MaxAttempts)
+			a.Equal(10*time.Millisecond, k.outputRetryPolicy.InitialBackoff)
+
+			a.NoError(k.Run(ctx))
+			for k.Stats().Completed < 2 {
+				time.Sleep(time.Millisecond)
+			}
+			a.NoError(k.Close(ctx))
+			data, err := os.ReadFile(output)
+			a.NoError(err)
+			a.ElementsMatch([]string{"name=a", "name=b"}, strings.Fields(string(data)))
+		})
+	}
+}
+
+func TestNewFromConfigErrors(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "input")
+	assert.NoError(t, os.WriteFile(path, nil, 0o644))
+	pipeline := func(transformer string) string {
+		return "input: {type: file, config: {path: " + path + "}}\n" +
+			"extractor: {type: json}\n" +
+			"transformer: " + transformer + "\n" +
+			"output: {type: file, config: {path: " + path + ".out}}\n"
+	}
+
+	_, err := NewFromConfig(ctx, []byte(pipeline("{type: missing}")))
+	assert.ErrorIs(t, err, ErrUnknownPlugin)
+	_, err = NewFromConfig(ctx, []byte(pipeline("{}")))
+	assert.ErrorIs(t, err, ErrMissingPlugin)
+	_, err = NewFromConfig(ctx, []byte(pipeline("{type: config-test-name, config: {prefx: a}}")))
+	assert.ErrorContains(t, err, "prefx")
+	_, err = NewFromConfig(ctx, []byte(pipeline("{type: config-test-name}")+"options: {max_goroutine: 1}\n"))
+	assert.ErrorContains(t, err, "max_goroutine")
+
+	outputs := "input: {type: file, config: {path: " + path + "}}\n" +
+		"extractor: {type: json}\n" +
+		"transformer: {type: config-test-name}\n" +
+		"outputs:\n" +
+		"- {type: file, config: {path: " + path + ".1}}\n" +
+		"- {type: file, config: {path: " + path + ".2}}\n"
+	k, err := NewFromConfig(ctx, []byte(outputs+"ack_policy: any\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, AckAny, k.output.(*multiOutput).policy)
+	assert.Len(t, k.output.(*multiOutput).outputs, 2)
+	assert.NoError(t, k.input.Close(ctx))
+	assert.NoError(t, k.output.Close(ctx))
+	_, err = NewFromConfig(ctx, []byte(outputs+"ack_policy: some\n"))
+	assert.ErrorContains(t, err, "ack policy")
+}
@@ -6,4 +6,11 @@ const (
 	inputMessageExtractorEventName    = "inputMessageExtractor"
 	commitMessageEventName            = "commitMessage"
 	inputMessageEventName             = "inputMessage"
+	orderedProcessEventName           = "orderedProcess"
+	orderedLaneEventName              = "orderedLane"
+	orderedAggregateEventName         = "orderedAggregate"
+	batchMessageEventName             = "batchMessage"
+	reportMetricsEventName            = "reportMetrics"
+	backpressureEventName             = "backpressure"
+	transactionMessageEventName       = "transactionMessage"
 )
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"context"
+)
+
+// Aggregate is an output combining several messages, e.g. the result of a window.
+type Aggregate struct {
+	// Message describes the aggregate to the middlewares of the output stage.
+	Message Message
+	Output  *OutputMessage
+	// Inputs are the held messages which contributed to the aggregate, kq matches them with the
+	// processed messages by == or, for types which cannot be compared, by ID.
+	Inputs []Message
+}
+
+// Emit sends an aggregate through the output stage.
+type Emit func(aggregate *Aggregate)
+
+// Aggregator is a Transformer combining several messages into aggregates it emits on its own schedule.
+// Process returns Hold for the messages it keeps, kq leaves their inputs unacked until every aggregate
+// listing them has been delivered. Aggregators must be the transformer of the pipeline, not part of a chain.
+type Aggregator interface {
+	Transformer
+	// Open is called by kq before the first message, ctx is done once kq is closed.
+	Open(ctx context.Context, emit Emit)
+	// Flush emits every pending aggregate, kq calls it when closing once the input stopped.
+	Flush(ctx context.Context)
+}
+
+// Hold is returned by Aggregator.Process for a message which will be listed by the given number of aggregates.
+func Hold(aggregates int) *OutputMessage {
+	return &OutputMessage{held: aggregates}
+}
+
+// Held returns the number of aggregates a message returned by Hold waits for.
+func (m *OutputMessage) Held() int {
+	return m.held
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	StageExtractor   = "extractor"
+	StageTransformer = "transformer"
+	StageOutput      = "output"
+)
+
+// DeadLetterMessage describes a message that failed in one of the pipeline stages.
+type DeadLetterMessage struct {
+	Raw      *sarama.ConsumerMessage
+	Stage    string
+	Err      error
+	Attempts int
+	FailedAt time.Time
+}
+
+// DeadLetter receives the messages kq gives up on, before they are acked.
+type DeadLetter interface {
+	SendDeadLetter(ctx context.Context, message *DeadLetterMessage) error
+	Close(ctx context.Context) error
+}
@@ -2,9 +2,11 @@ package core
 
 import (
 	"context"
+	"errors"
 	"sync"
 
 	"github.com/IBM/sarama"
+	"go.uber.org/atomic"
 )
 
 var (
@@ -19,27 +21,66 @@ func NewInputMessage() *InputMessage {
 	return inputMessagePool.Get().(*InputMessage)
 }
 
+// Release resets the message and puts it back to the pool, it must not be used afterwards.
 func (m *InputMessage) Release() {
+	m.Raw = nil
+	m.onAck = nil
+	m.acked.Store(false)
 	inputMessagePool.Put(m)
 }
 
 type InputMessage struct {
-	Raw  *sarama.ConsumerMessage
-	done sync.Mutex
+	Raw   *sarama.ConsumerMessage
+	acked atomic.Bool
+	onAck func(m *InputMessage)
 }
 
 // Ack acknowledges that the message has been processed.
-// It will release the internal lock on the message, allowing the message to be marked in kafka.
+// Only the first call counts, it notifies the owner of the message so that the offset can be committed
+// once every message before it in the same partition has been acked as well.
 func (m *InputMessage) Ack() {
-	m.done.Unlock()
+	onAck := m.onAck
+	if m.acked.CompareAndSwap(false, true) && onAck != nil {
+		onAck(m)
+	}
+}
+
+// Acked reports whether Ack has been called.
+func (m *InputMessage) Acked() bool {
+	return m.acked.Load()
 }
 
-func (m *InputMessage) Lock() {
-	m.done.Lock()
+// OnAck registers fn to be called when the message is acked.
+func (m *InputMessage) OnAck(fn func(m *InputMessage)) {
+	m.onAck = fn
 }
 
+var (
+	// ErrInputClosed is returned by Consumer once the input is closed or has no more messages,
+	// kq stops pulling when it sees it.
+	ErrInputClosed = errors.New("input closed")
+)
+
+// Input is the source of the pipeline.
+// Consumer blocks until a message is available, ctx is done or the input is closed, it should not
+// return a nil message without an error, kq takes it as an empty poll and backs off. Errors other than
+// ctx.Err() and ErrInputClosed are reported to the error handler of kq and Consumer is called again
+// after a backoff.
 type Input interface {
 	Consumer(ctx context.Context) (*InputMessage, error)
 	CommitMessage(ctx context.Context, inputMessage *InputMessage) error
 	Close(ctx context.Context) error
 }
+
+// HighWaterMarker is implemented by inputs which know the offset the next produced message
+// will get in every partition, kq uses it to report the lag.
+type HighWaterMarker interface {
+	HighWaterMarks() map[string]map[int32]int64
+}
+
+// Pausable is implemented by inputs which can stop fetching upstream while kq is paused,
+// Consumer is not called while paused so inputs without it only buffer what they already fetched.
+type Pausable interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+}
@@ -1,6 +1,51 @@
 package core
 
-type Middleware interface {
-	Input
-	Output
+import (
+	"context"
+)
+
+// StageMessage is what a pipeline stage works on.
+// Message is set once the extractor stage succeeded and Output once the transformer stage succeeded.
+type StageMessage struct {
+	Stage    string
+	Input    *InputMessage
+	Message  Message
+	Output   *OutputMessage
+	Attempts int
+
+	onSent []func(ctx context.Context, err error)
+}
+
+// OnSent registers fn to be called once the output stage of the message is over: err is nil when
+// every output was sent or the message was dropped, and the error it was given up with otherwise.
+// In batch mode it is called after the batch is sent, not when the output handler returns, in
+// exactly-once mode once the transaction is committed or aborted, and for a message held by an
+// Aggregator once the aggregates listing it were sent or failed.
+func (m *StageMessage) OnSent(fn func(ctx context.Context, err error)) {
+	m.onSent = append(m.onSent, fn)
+}
+
+// Sent calls the functions registered with OnSent, kq calls it when the output stage is over.
+func (m *StageMessage) Sent(ctx context.Context, err error) {
+	for _, fn := range m.onSent {
+		fn(ctx, err)
+	}
+}
+
+// Handler runs a pipeline stage for a message.
+type Handler func(ctx context.Context, message *StageMessage) error
+
+// Middleware wraps the handler of every stage.
+// Returning an error fails the stage, returning nil without calling next drops the message,
+// which is then acked without reaching the following stages.
+type Middleware func(next Handler) Handler
+
+// Chain composes middlewares, the first one is the outermost.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
 }
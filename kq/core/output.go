@@ -7,6 +7,20 @@ import (
 type OutputMessage struct {
 	Ctx  context.Context
 	Data interface{}
+	// Children, when not nil, replaces the message by several ones: kq sends every child to the
+	// output and acks the input once all of them completed, Data is ignored.
+	// Empty children drop the message like a nil OutputMessage.
+	Children []*OutputMessage
+
+	held int
+}
+
+// Outputs returns the children of a message, or the message itself when it has none.
+func (m *OutputMessage) Outputs() []*OutputMessage {
+	if m.Children != nil {
+		return m.Children
+	}
+	return []*OutputMessage{m}
 }
 
 type Output interface {
@@ -15,3 +29,25 @@ type Output interface {
 	OnError(cxt context.Context, message *OutputMessage, err error)
 	Close(ctx context.Context) error
 }
+
+// BatchOutput is an Output which can send several messages at once,
+// kq uses SendOutputs when batching is enabled.
+type BatchOutput interface {
+	Output
+	SendOutputs(ctx context.Context, messages []*OutputMessage) error
+}
+
+// PartialError is returned by SendOutputs when only some of the messages failed,
+// kq retries and fails only the Failed ones.
+type PartialError struct {
+	Failed []*OutputMessage
+	Err    error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PluginConfig decodes the plugin specific part of a pipeline configuration,
+// v is usually a pointer to a struct with yaml tags.
+type PluginConfig interface {
+	Decode(v interface{}) error
+}
+
+type (
+	InputFactory       func(ctx context.Context, config PluginConfig) (Input, error)
+	ExtractorFactory   func(ctx context.Context, config PluginConfig) (Extractor, error)
+	TransformerFactory func(ctx context.Context, config PluginConfig) (Transformer, error)
+	OutputFactory      func(ctx context.Context, config PluginConfig) (Output, error)
+	DeadLetterFactory  func(ctx context.Context, config PluginConfig) (DeadLetter, error)
+)
+
+var (
+	inputs       = newRegistry[InputFactory]("input")
+	extractors   = newRegistry[ExtractorFactory]("extractor")
+	transformers = newRegistry[TransformerFactory]("transformer")
+	outputs      = newRegistry[OutputFactory]("output")
+	deadLetters  = newRegistry[DeadLetterFactory]("dead letter")
+)
+
+// RegisterInput makes an input available by name to configured pipelines,
+// it panics when the name is already taken or factory is nil.
+// Plugin packages register themselves in init, like database/sql drivers.
+func RegisterInput(name string, factory InputFactory) {
+	inputs.register(name, factory, factory == nil)
+}
+
+// RegisterExtractor makes an extractor available by name, see RegisterInput.
+func RegisterExtractor(name string, factory ExtractorFactory) {
+	extractors.register(name, factory, factory == nil)
+}
+
+// RegisterTransformer makes a transformer available by name, see RegisterInput.
+func RegisterTransformer(name string, factory TransformerFactory) {
+	transformers.register(name, factory, factory == nil)
+}
+
+// RegisterOutput makes an output available by name, see RegisterInput.
+func RegisterOutput(name string, factory OutputFactory) {
+	outputs.register(name, factory, factory == nil)
+}
+
+// RegisterDeadLetter makes a dead letter available by name, see RegisterInput.
+func RegisterDeadLetter(name string, factory DeadLetterFactory) {
+	deadLetters.register(name, factory, factory == nil)
+}
+
+func LookupInput(name string) (InputFactory, bool) {
+	return inputs.lookup(name)
+}
+
+func LookupExtractor(name string) (ExtractorFactory, bool) {
+	return extractors.lookup(name)
+}
+
+func LookupTransformer(name string) (TransformerFactory, bool) {
+	return transformers.lookup(name)
+}
+
+func LookupOutput(name string) (OutputFactory, bool) {
+	return outputs.lookup(name)
+}
+
+func LookupDeadLetter(name string) (DeadLetterFactory, bool) {
+	return deadLetters.lookup(name)
+}
+
+type registry[F any] struct {
+	kind      string
+	mu        sync.RWMutex
+	factories map[string]F
+}
+
+func newRegistry[F any](kind string) *registry[F] {
+	return &registry[F]{kind: kind, factories: make(map[string]F)}
+}
+
+func (r *registry[F]) register(name string, factory F, isNil bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if isNil {
+		panic(fmt.Sprintf("kq: register %s %q: nil factory", r.kind, name))
+	}
+	if _, ok := r.factories[name]; ok {
+		panic(fmt.Sprintf("kq: register %s %q twice", r.kind, name))
+	}
+	r.factories[name] = factory
+}
+
+func (r *registry[F]) lookup(name string) (F, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.factories[name]
+	return factory, ok
+}
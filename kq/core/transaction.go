@@ -0,0 +1,23 @@
+package core
+
+import (
+	"context"
+)
+
+// TransactionalOutput sends outputs inside transactions which also commit the input offsets,
+// kq uses it in exactly-once mode.
+type TransactionalOutput interface {
+	Output
+	BeginTransaction(ctx context.Context) error
+	// CommitTransaction commits the outputs sent since BeginTransaction together with the offsets
+	// of inputs, the last processed message of every partition.
+	CommitTransaction(ctx context.Context, inputs []*InputMessage) error
+	AbortTransaction(ctx context.Context) error
+}
+
+// Rewinder is implemented by inputs which can consume again from their last committed offsets,
+// kq rewinds the input after aborting a transaction. Messages returned by Consumer before Rewind
+// are not returned again unless they come after the committed offsets.
+type Rewinder interface {
+	Rewind(ctx context.Context) error
+}
@@ -0,0 +1,161 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	defaultInputErrorBackoff    = 10 * time.Millisecond
+	defaultInputErrorMaxBackoff = 5 * time.Second
+	defaultEmptyPollMaxBackoff  = time.Second
+)
+
+// InputHealth describes the errors returned by core.Input.Consumer,
+// the input is healthy again after the first message consumed following an error.
+type InputHealth struct {
+	Healthy           bool
+	Errors            uint64
+	ConsecutiveErrors int
+	LastError         error
+	LastErrorAt       time.Time
+}
+
+type inputHealth struct {
+	mu     sync.RWMutex
+	health InputHealth
+}
+
+func newInputHealth() *inputHealth {
+	return &inputHealth{health: InputHealth{Healthy: true}}
+}
+
+func (h *inputHealth) onError(err error) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.health.Healthy = false
+	h.health.Errors++
+	h.health.ConsecutiveErrors++
+	h.health.LastError = err
+	h.health.LastErrorAt = time.Now()
+	return h.health.ConsecutiveErrors
+}
+
+func (h *inputHealth) onMessage() {
+	h.mu.RLock()
+	healthy := h.health.Healthy
+	h.mu.RUnlock()
+	if healthy {
+		return
+	}
+	h.mu.Lock()
+	h.health.Healthy = true
+	h.health.ConsecutiveErrors = 0
+	h.mu.Unlock()
+}
+
+func (h *inputHealth) load() InputHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.health
+}
+
+// InputHealth returns the health of the input.
+func (k *KQ) InputHealth() InputHealth {
+	return k.inputHealth.load()
+}
+
+// inputMessage pulls from the input with inputCtx, which Close cancels first,
+// while ctx keeps the hand-over to the extractor stage alive until the pipeline stops.
+// It returns once the input reports core.ErrInputClosed.
+// A nil message without error counts as an empty poll, the input is pulled again after a backoff.
+func (k *KQ) inputMessage(ctx, inputCtx context.Context) error {
+	emptyPolls := 0
+	for {
+		select {
+		case <-k.pause.wait():
+		case <-inputCtx.Done():
+			return nil
+		}
+		consumeCtx := inputCtx
+		if k.transaction != nil {
+			txnCtx, ok := k.transaction.wait(inputCtx)
+			if !ok {
+				return nil
+			}
+			consumeCtx = txnCtx
+		}
+		m, err := k.input.Consumer(consumeCtx)
+		if err != nil {
+			if inputCtx.Err() != nil || errors.Is(err, core.ErrInputClosed) {
+				return nil
+			}
+			if consumeCtx.Err() != nil {
+				// the transaction ended
+				continue
+			}
+			if !k.inputError(inputCtx, err) {
+				return nil
+			}
+			continue
+		}
+		if m == nil {
+			emptyPolls++
+			if !sleep(inputCtx, backoff(emptyPolls, defaultEmptyPollMaxBackoff)) {
+				return nil
+			}
+			continue
+		}
+		emptyPolls = 0
+		k.inputHealth.onMessage()
+		k.offsetTracker.track(m)
+		if k.transaction != nil {
+			k.transaction.add()
+		}
+		k.incConsumed()
+		select {
+		case k.inputMessageChannel <- m:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// inputError reports err and waits for an exponential backoff before the input is pulled again,
+// it returns false when ctx is done while waiting.
+func (k *KQ) inputError(ctx context.Context, err error) bool {
+	consecutiveErrors := k.inputHealth.onError(err)
+	if k.metricsSink != nil {
+		k.metricsSink.AddCounter(metricInputErrors, nil, 1)
+	}
+	k.inputErrorHandler(err)
+	return sleep(ctx, backoff(consecutiveErrors, defaultInputErrorMaxBackoff))
+}
+
+// backoff doubles defaultInputErrorBackoff for every consecutive attempt, up to maxBackoff.
+func backoff(attempts int, maxBackoff time.Duration) time.Duration {
+	d := defaultInputErrorBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// sleep waits for d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package kq
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// BenchmarkKQIdle reports the CPU time the process spends per op while kq waits on an empty input,
+// every op is 10ms of idle wall time.
+func BenchmarkKQIdle(b *testing.B) {
+	ctx := context.Background()
+	k := newTestKQ(ctx, newTestInput(1, 0), &testTransformer{}, &testOutput{})
+	_ = k.Run(ctx)
+	defer func() { _ = k.Close(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+
+	before := cpuTime(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(cpuTime(b)-before)/float64(b.N), "cpu-ns/op")
+}
+
+func cpuTime(b *testing.B) time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		b.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -0,0 +1,123 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedInput returns errs first, then messages, then core.ErrInputClosed.
+type scriptedInput struct {
+	testInput
+
+	mu       sync.Mutex
+	errs     []error
+	messages []*sarama.ConsumerMessage
+}
+
+func (in *scriptedInput) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if len(in.errs) > 0 {
+		err := in.errs[0]
+		in.errs = in.errs[1:]
+		return nil, err
+	}
+	if len(in.messages) == 0 {
+		return nil, core.ErrInputClosed
+	}
+	m := core.NewInputMessage()
+	m.Raw = in.messages[0]
+	in.messages = in.messages[1:]
+	return m, nil
+}
+
+func TestKQInputErrors(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	fetchErr := errors.New("fetch")
+	input := &scriptedInput{
+		testInput: testInput{committed: make(map[int32]int64)},
+		errs:      []error{fetchErr, fetchErr},
+		messages:  []*sarama.ConsumerMessage{{Topic: "test", Value: []byte("0")}},
+	}
+	var mu sync.Mutex
+	var handled []error
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output, WithInputErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, err)
+	}))
+	a.True(k.InputHealth().Healthy)
+	a.NoError(k.Run(ctx))
+	select {
+	case <-k.inputDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("input loop did not stop on core.ErrInputClosed")
+	}
+	for output.count() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	mu.Lock()
+	a.Equal([]error{fetchErr, fetchErr}, handled)
+	mu.Unlock()
+	health := k.Stats().Input
+	a.True(health.Healthy)
+	a.Equal(uint64(2), health.Errors)
+	a.Equal(0, health.ConsecutiveErrors)
+	a.ErrorIs(health.LastError, fetchErr)
+	a.False(health.LastErrorAt.IsZero())
+}
+
+func BenchmarkKQThroughput(b *testing.B) {
+	ctx := context.Background()
+	input := newTestInput(4, b.N)
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output)
+	b.ReportAllocs()
+	b.ResetTimer()
+	_ = k.Run(ctx)
+	for k.Stats().Completed < uint64(b.N) {
+		time.Sleep(100 * time.Microsecond)
+	}
+	b.StopTimer()
+	_ = k.Close(ctx)
+}
+
+// emptyInput never has a message and does not block.
+type emptyInput struct {
+	testInput
+	mu    sync.Mutex
+	polls int
+}
+
+func (in *emptyInput) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.polls++
+	return nil, nil
+}
+
+func TestKQInputEmptyPolls(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := &emptyInput{testInput: testInput{committed: make(map[int32]int64)}}
+	k := newTestKQ(ctx, input, &testTransformer{}, &testOutput{})
+	a.NoError(k.Run(ctx))
+	time.Sleep(100 * time.Millisecond)
+	a.NoError(k.Close(ctx))
+	input.mu.Lock()
+	defer input.mu.Unlock()
+	a.Less(input.polls, 10, "empty polls back off")
+	a.True(k.InputHealth().Healthy)
+}
@@ -2,15 +2,17 @@ package kq
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"runtime"
 	"sync"
 	"time"
 
 	"github.com/colinrs/pkgx/concurrent"
 	goSafe "github.com/colinrs/pkgx/fx"
 	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/metrics"
 
+	"github.com/zeromicro/go-zero/core/errorx"
 	"go.uber.org/atomic"
 )
 
@@ -25,16 +27,50 @@ type KQ struct {
 
 	input       core.Input
 	extractor   core.Extractor
-	middleware  core.Middleware
+	middlewares []core.Middleware
 	transformer core.Transformer
+	aggregator  core.Aggregator
 	output      core.Output
+	deadLetter  core.DeadLetter
 
 	inputMessageChannel  chan *core.InputMessage
-	commitMessageChanel  chan *core.InputMessage
+	offsetTracker        *offsetTracker
 	extractorMessageChan chan *internalMessage
 	outPutMessageChanel  chan *internalMessage
 	limitGoroutines      *concurrent.Limit
 	maxGoroutines        int
+
+	transformerRetryPolicy *RetryPolicy
+	outputRetryPolicy      *RetryPolicy
+	lanes                  int
+	laneChannelSize        int
+	keyFunc                KeyFunc
+	batchOptions           *BatchOptions
+	batchOutput            core.BatchOutput
+	batchChannel           chan *internalMessage
+	batchLimit             *concurrent.Limit
+	metricsSink            metrics.Sink
+	metricsInterval        time.Duration
+	backpressureOptions    *BackpressureOptions
+	transactionOptions     *TransactionOptions
+	transaction            *transaction
+	pause                  *pauseGate
+	inputErrorHandler      func(err error)
+	inputHealth            *inputHealth
+	holds                  *holds
+
+	consumed   *atomic.Uint64
+	completed  *atomic.Uint64
+	stageStats map[string]*stageStats
+
+	extractHandler   core.Handler
+	transformHandler core.Handler
+	outputHandler    core.Handler
+
+	cancel    context.CancelFunc
+	stopInput context.CancelFunc
+	inputDone chan struct{}
+	loops     sync.WaitGroup
 }
 
 var (
@@ -52,6 +88,10 @@ func NewKQ(ctx context.Context, opts ...Option) *KQ {
 		commitMessageChannelSize:    defaultCommitMessageChannelSize,
 		extractorMessageChannelSize: defaultExtractorMessageChannelSize,
 		outPutMessageChannelSize:    defaultOutPutMessageChannelSize,
+		metricsInterval:             defaultMetricsInterval,
+		inputErrorHandler: func(err error) {
+			fmt.Printf("kq input consumer. err=[%v]\n", err)
+		},
 	}
 	for _, opt := range opts {
 		opt(o)
@@ -60,10 +100,31 @@ func NewKQ(ctx context.Context, opts ...Option) *KQ {
 	return &KQ{
 		kqStatus:             atomic.NewInt32(kqStatusInit),
 		inputMessageChannel:  make(chan *core.InputMessage, o.inputMessageChannelSize),
-		commitMessageChanel:  make(chan *core.InputMessage, o.commitMessageChannelSize),
+		offsetTracker:        newOffsetTracker(),
 		extractorMessageChan: make(chan *internalMessage, o.extractorMessageChannelSize),
-		outPutMessageChanel:  make(chan *internalMessage, o.extractorMessageChannelSize),
+		outPutMessageChanel:  make(chan *internalMessage, o.outPutMessageChannelSize),
 		limitGoroutines:      concurrent.NewLimit(o.maxGoroutines),
+		maxGoroutines:        o.maxGoroutines,
+		inputDone:            make(chan struct{}),
+
+		transformerRetryPolicy: o.transformerRetryPolicy,
+		outputRetryPolicy:      o.outputRetryPolicy,
+		lanes:                  o.lanes,
+		laneChannelSize:        o.extractorMessageChannelSize,
+		keyFunc:                o.keyFunc,
+		batchOptions:           o.batchOptions,
+		metricsSink:            o.metricsSink,
+		metricsInterval:        o.metricsInterval,
+		backpressureOptions:    o.backpressureOptions,
+		transactionOptions:     o.transactionOptions,
+		pause:                  newPauseGate(),
+		inputErrorHandler:      o.inputErrorHandler,
+		inputHealth:            newInputHealth(),
+		holds:                  newHolds(),
+
+		consumed:   atomic.NewUint64(0),
+		completed:  atomic.NewUint64(0),
+		stageStats: newStageStats(),
 	}
 }
 
@@ -77,8 +138,10 @@ func (k *KQ) SetExtractor(ctx context.Context, extractor core.Extractor) *KQ {
 	return k
 }
 
-func (k *KQ) SetMiddleware(ctx context.Context, middleware core.Middleware) *KQ {
-	k.middleware = middleware
+// SetMiddleware sets the interceptors wrapping the extractor, transformer and output stages,
+// the first middleware is the outermost.
+func (k *KQ) SetMiddleware(ctx context.Context, middlewares ...core.Middleware) *KQ {
+	k.middlewares = middlewares
 	return k
 }
 
@@ -92,64 +155,93 @@ func (k *KQ) SetOutput(ctx context.Context, output core.Output) *KQ {
 	return k
 }
 
+// SetDeadLetter sets where messages that failed in the extractor, transformer or output
+// stage are sent before being acked. A message the dead letter rejects, even after the output
+// retry policy, is left unacked.
+func (k *KQ) SetDeadLetter(ctx context.Context, deadLetter core.DeadLetter) *KQ {
+	k.deadLetter = deadLetter
+	return k
+}
+
 func (k *KQ) Run(ctx context.Context) error {
-	k.kqStatus.Store(kqStatusRunning)
-	goSafe.GoSafeWithRecover(func() {
-		err := k.inputMessage(ctx)
-		if err != nil {
-			fmt.Println(err.Error())
+	k.aggregator, _ = k.transformer.(core.Aggregator)
+	if k.transactionOptions != nil {
+		if k.aggregator != nil {
+			return ErrAggregatorExactlyOnce
 		}
-	}, kqRecover(inputMessageEventName))
-	goSafe.GoSafeWithRecover(func() {
-		err := k.commitMessage(ctx)
-		if err != nil {
-			fmt.Println(err.Error())
+		_, transactional := k.output.(core.TransactionalOutput)
+		_, rewinder := k.input.(core.Rewinder)
+		if !transactional || !rewinder {
+			return ErrNotTransactional
 		}
-	}, kqRecover(commitMessageEventName))
-	goSafe.GoSafeWithRecover(func() {
-		err := k.inputMessageExtractor(ctx)
-		if err != nil {
-			fmt.Println(err.Error())
-		}
-	}, kqRecover(inputMessageExtractorEventName))
-	goSafe.GoSafeWithRecover(func() {
-		err := k.extractorMessageProcess(ctx)
-		if err != nil {
-			fmt.Println(err.Error())
+		k.transaction = newTransaction(k.transactionOptions.MaxMessages)
+	}
+	if batchOutput, ok := k.output.(core.BatchOutput); ok && k.batchOptions != nil {
+		k.batchOutput = batchOutput
+		k.batchChannel = make(chan *internalMessage, k.batchOptions.MaxSize)
+		k.batchLimit = concurrent.NewLimit(k.maxGoroutines)
+		if k.lanes > 0 {
+			k.batchLimit = concurrent.NewLimit(1)
 		}
-	}, kqRecover(extractorMessageProcessEventName))
-	goSafe.GoSafeWithRecover(func() {
-		err := k.transformerMessageOutPut(ctx)
-		if err != nil {
-			fmt.Println(err.Error())
+	}
+	k.buildHandlers()
+	k.kqStatus.Store(kqStatusRunning)
+	runCtx, cancel := context.WithCancel(ctx)
+	inputCtx, stopInput := context.WithCancel(runCtx)
+	k.cancel = cancel
+	k.stopInput = stopInput
+	if k.aggregator != nil {
+		k.aggregator.Open(runCtx, func(aggregate *core.Aggregate) {
+			k.emit(runCtx, aggregate)
+		})
+	}
+	k.goLoop(runCtx, inputMessageEventName, func(ctx context.Context) error {
+		return k.inputMessage(ctx, inputCtx)
+	}, func() {
+		close(k.inputDone)
+	})
+	if k.transaction != nil {
+		k.goLoop(runCtx, transactionMessageEventName, func(ctx context.Context) error {
+			return k.transactionMessage(ctx, inputCtx)
+		})
+	} else {
+		k.goLoop(runCtx, commitMessageEventName, k.commitMessage)
+	}
+	if k.metricsSink != nil {
+		k.goLoop(runCtx, reportMetricsEventName, k.reportMetrics)
+	}
+	if k.batchOutput != nil {
+		k.goLoop(runCtx, batchMessageEventName, k.batchMessage)
+	}
+	if k.backpressureOptions != nil {
+		k.goLoop(runCtx, backpressureEventName, k.backpressure)
+	}
+	if k.lanes > 0 {
+		k.goLoop(runCtx, orderedProcessEventName, k.orderedProcess)
+		if k.aggregator != nil {
+			k.goLoop(runCtx, orderedAggregateEventName, k.orderedAggregate)
 		}
-	}, kqRecover(transformerMessageOutPutEventName))
+		return nil
+	}
+	k.goLoop(runCtx, inputMessageExtractorEventName, k.inputMessageExtractor)
+	k.goLoop(runCtx, extractorMessageProcessEventName, k.extractorMessageProcess)
+	k.goLoop(runCtx, transformerMessageOutPutEventName, k.transformerMessageOutPut)
 	return nil
 }
 
-func (k *KQ) inputMessage(ctx context.Context) error {
-	ticket := time.Tick(time.Millisecond * 500)
-	for k.kqStatus.Load() == kqStatusRunning {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-ticket:
-			runtime.Gosched()
-		default:
-			m, err := k.input.Consumer(ctx)
-			if err != nil || m == nil {
-				continue
-			}
-			m.Lock()
-			k.inputMessageChannel <- m
-			k.commitMessageChanel <- m
+func (k *KQ) goLoop(ctx context.Context, eventName string, loop func(ctx context.Context) error, cleanups ...func()) {
+	k.loops.Add(1)
+	cleanups = append(cleanups, k.loops.Done)
+	goSafe.GoSafeWithRecover(func() {
+		err := loop(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Printf("%s exit:%s\n", eventName, err.Error())
 		}
-	}
-	return nil
+	}, kqRecover(eventName, cleanups...))
 }
 
 func (k *KQ) inputMessageExtractor(ctx context.Context) error {
-	for k.kqStatus.Load() == kqStatusRunning {
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -159,27 +251,23 @@ func (k *KQ) inputMessageExtractor(ctx context.Context) error {
 			}
 			k.limitGoroutines.Acquire()
 			goSafe.GoSafeWithRecover(func() {
-				extractorMessage, err := k.extractor.Unmarshal(ctx, inputMessage)
-				iMessage := getInternalMessage()
-				iMessage.inputMessage = inputMessage
-				iMessage.extractorMessage = extractorMessage
-				if err != nil {
-					inputMessage.Ack()
-					k.extractor.OnError(ctx, inputMessage, err)
-				} else {
-					k.extractor.OnDone(ctx, inputMessage)
-					k.extractorMessageChan <- iMessage
+				iMessage := k.extract(ctx, inputMessage)
+				if iMessage == nil {
+					return
+				}
+				select {
+				case k.extractorMessageChan <- iMessage:
+				case <-ctx.Done():
 				}
 			}, kqRecover(inputMessageExtractorEventName, func() {
 				k.limitGoroutines.Release()
 			}))
 		}
 	}
-	return nil
 }
 
 func (k *KQ) extractorMessageProcess(ctx context.Context) error {
-	for k.kqStatus.Load() == kqStatusRunning {
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -189,27 +277,22 @@ func (k *KQ) extractorMessageProcess(ctx context.Context) error {
 			}
 			k.limitGoroutines.Acquire()
 			goSafe.GoSafeWithRecover(func() {
-				defer k.limitGoroutines.Release()
-				outPutMessage, err := k.transformer.Process(ctx, iMessage.extractorMessage)
-				if err != nil {
-					iMessage.inputMessage.Ack()
-					k.transformer.OnError(ctx, iMessage.extractorMessage, err)
-				} else {
-					k.transformer.OnDone(ctx, iMessage.extractorMessage)
-					iMessage.outPutMessage = outPutMessage
-					iMessage.extractorMessage = nil
-					k.outPutMessageChanel <- iMessage
+				if !k.transform(ctx, iMessage) {
+					return
+				}
+				select {
+				case k.outPutMessageChanel <- iMessage:
+				case <-ctx.Done():
 				}
 			}, kqRecover(transformerMessageOutPutEventName, func() {
 				k.limitGoroutines.Release()
 			}))
 		}
 	}
-	return nil
 }
 
 func (k *KQ) transformerMessageOutPut(ctx context.Context) error {
-	for k.kqStatus.Load() == kqStatusRunning {
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -219,54 +302,318 @@ func (k *KQ) transformerMessageOutPut(ctx context.Context) error {
 			}
 			k.limitGoroutines.Acquire()
 			goSafe.GoSafeWithRecover(func() {
-				err := k.output.SendOutput(ctx, iMessage.outPutMessage)
-				if err != nil {
-					k.output.OnError(ctx, iMessage.outPutMessage, err)
-				} else {
-					k.output.OnDone(ctx, iMessage.outPutMessage)
-				}
-				iMessage.inputMessage.Ack()
-				iMessage.inputMessage = nil
-				iMessage.outPutMessage = nil
-				putInternalMessage(iMessage)
+				k.send(ctx, iMessage)
 			}, kqRecover(transformerMessageOutPutEventName, func() {
 				k.limitGoroutines.Release()
 			}))
 		}
 	}
-	return nil
 }
 
+// extract runs the extractor stage, a message that failed or was dropped is finished and nil is returned.
+func (k *KQ) extract(ctx context.Context, inputMessage *core.InputMessage) *internalMessage {
+	iMessage := getInternalMessage()
+	iMessage.Stage = core.StageExtractor
+	iMessage.Input = inputMessage
+	start := time.Now()
+	err := k.extractHandler(ctx, &iMessage.StageMessage)
+	k.observeStage(core.StageExtractor, time.Since(start), err)
+	if err != nil {
+		k.extractor.OnError(ctx, inputMessage, err)
+		k.finishFailed(iMessage, k.sendDeadLetter(ctx, inputMessage, core.StageExtractor, 1, err))
+		return nil
+	}
+	if iMessage.Message == nil {
+		k.finish(iMessage)
+		return nil
+	}
+	k.extractor.OnDone(ctx, inputMessage)
+	return iMessage
+}
+
+// transform runs the transformer stage, a message that failed or was dropped is finished and false is returned.
+func (k *KQ) transform(ctx context.Context, iMessage *internalMessage) bool {
+	iMessage.Stage = core.StageTransformer
+	iMessage.Attempts = 0
+	start := time.Now()
+	err := k.transformHandler(ctx, &iMessage.StageMessage)
+	k.observeStage(core.StageTransformer, time.Since(start), err)
+	if err != nil {
+		k.transformer.OnError(ctx, iMessage.Message, err)
+		k.finishFailed(iMessage, k.sendDeadLetter(ctx, iMessage.Input, core.StageTransformer, iMessage.Attempts, err))
+		return false
+	}
+	if iMessage.Output == nil || len(iMessage.Output.Outputs()) == 0 {
+		k.finish(iMessage)
+		return false
+	}
+	k.transformer.OnDone(ctx, iMessage.Message)
+	if iMessage.Output.Held() > 0 {
+		k.hold(iMessage)
+		return false
+	}
+	return true
+}
+
+// send runs the output stage and acks the message, unless it failed and the dead letter too.
+// In batch mode a message which went through the middlewares is acked once its batch is sent.
+func (k *KQ) send(ctx context.Context, iMessage *internalMessage) {
+	iMessage.Stage = core.StageOutput
+	iMessage.Attempts = 0
+	start := time.Now()
+	err := k.outputHandler(ctx, &iMessage.StageMessage)
+	k.observeStage(core.StageOutput, time.Since(start), err)
+	if err != nil {
+		k.finishFailed(iMessage, k.outputError(ctx, iMessage, err))
+		return
+	}
+	if iMessage.Attempts > 0 {
+		if k.batchOutput != nil {
+			select {
+			case k.batchChannel <- iMessage:
+				return
+			case <-ctx.Done():
+			}
+		} else {
+			k.outputDone(ctx, iMessage)
+		}
+	} else {
+		// dropped by a middleware
+		k.sent(ctx, iMessage, nil)
+	}
+	k.finish(iMessage)
+}
+
+func (k *KQ) outputDone(ctx context.Context, iMessage *internalMessage) {
+	for _, output := range iMessage.Output.Outputs() {
+		k.output.OnDone(ctx, output)
+	}
+	k.sent(ctx, iMessage, nil)
+}
+
+// sent calls the OnSent functions of the message. In exactly-once mode a message sent successfully
+// is only reported once its transaction is over, with the error of the transaction when it aborted.
+func (k *KQ) sent(ctx context.Context, iMessage *internalMessage, err error) {
+	if k.transaction == nil || err != nil {
+		iMessage.Sent(ctx, err)
+		return
+	}
+	stageMessage := iMessage.StageMessage
+	k.transaction.onEnd(func(ctx context.Context, err error) {
+		stageMessage.Sent(ctx, err)
+	})
+}
+
+// outputError reports a failed output, in exactly-once mode the transaction is aborted
+// and the message consumed again instead of going to the dead letter.
+// The error of the dead letter is returned, see finishFailed.
+func (k *KQ) outputError(ctx context.Context, iMessage *internalMessage, err error) error {
+	if iMessage.Output != nil {
+		for _, output := range iMessage.Output.Outputs() {
+			k.output.OnError(ctx, output, err)
+		}
+	}
+	iMessage.Sent(ctx, err)
+	if k.transaction != nil {
+		k.transaction.fail(err)
+		return nil
+	}
+	if iMessage.Input == nil {
+		k.failHolds(ctx, iMessage, err)
+		return nil
+	}
+	return k.sendDeadLetter(ctx, iMessage.Input, core.StageOutput, iMessage.Attempts, err)
+}
+
+// finish acks the input message and puts the internal message back to the pool,
+// for an aggregate the messages it lists are released instead.
+func (k *KQ) finish(iMessage *internalMessage) {
+	if iMessage.Input != nil {
+		iMessage.Input.Ack()
+		k.incCompleted()
+	}
+	k.putBack(iMessage)
+}
+
+// finishFailed finishes a failed message once the dead letter got it. Otherwise the input is left
+// unacked, so its offset is never committed and it is consumed again after a restart or a rebalance,
+// and in exactly-once mode its transaction is aborted.
+func (k *KQ) finishFailed(iMessage *internalMessage, deadLetterErr error) {
+	if deadLetterErr == nil {
+		k.finish(iMessage)
+		return
+	}
+	if iMessage.Input != nil {
+		k.offsetTracker.fail(iMessage.Input)
+		if raw := iMessage.Input.Raw; raw != nil {
+			fmt.Printf("kq message left unacked. topic=[%s], partition=[%d], offset=[%d], err=[%v]\n",
+				raw.Topic, raw.Partition, raw.Offset, deadLetterErr)
+		} else {
+			fmt.Printf("kq message left unacked. err=[%v]\n", deadLetterErr)
+		}
+	}
+	k.putBack(iMessage)
+}
+
+func (k *KQ) putBack(iMessage *internalMessage) {
+	if forgetter, ok := k.output.(forgetter); ok && iMessage.Output != nil {
+		forgetter.forget(iMessage.Output.Outputs())
+	}
+	inputs := iMessage.inputs
+	iMessage.StageMessage = core.StageMessage{}
+	iMessage.inputs = nil
+	putInternalMessage(iMessage)
+	for _, message := range inputs {
+		k.release(message)
+	}
+}
+
+// buildHandlers wraps the stage calls with the middleware chain,
+// in batch mode the output handler only lets the message through to the batch stage.
+func (k *KQ) buildHandlers() {
+	chain := core.Chain(k.middlewares...)
+	k.extractHandler = chain(func(ctx context.Context, message *core.StageMessage) error {
+		extractorMessage, err := k.extractor.Unmarshal(ctx, message.Input)
+		message.Attempts = 1
+		if err != nil {
+			return err
+		}
+		message.Message = extractorMessage
+		return nil
+	})
+	k.transformHandler = chain(func(ctx context.Context, message *core.StageMessage) error {
+		var err error
+		message.Attempts, err = k.retry(ctx, k.transformerRetryPolicy, func() error {
+			outPutMessage, err := k.transformer.Process(ctx, message.Message)
+			message.Output = outPutMessage
+			return err
+		})
+		return err
+	})
+	if k.batchOutput != nil {
+		k.outputHandler = chain(func(ctx context.Context, message *core.StageMessage) error {
+			message.Attempts = 1
+			return nil
+		})
+		return
+	}
+	k.outputHandler = chain(func(ctx context.Context, message *core.StageMessage) error {
+		var err error
+		outputs := message.Output.Outputs()
+		message.Attempts, err = k.retry(ctx, k.outputRetryPolicy, func() error {
+			// children already sent are not sent again by the next attempt
+			for len(outputs) > 0 {
+				if err := k.output.SendOutput(ctx, outputs[0]); err != nil {
+					return err
+				}
+				outputs = outputs[1:]
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+// sendDeadLetter sends a failed message to the dead letter with the output retry policy,
+// the error of the last attempt is returned.
+func (k *KQ) sendDeadLetter(ctx context.Context, inputMessage *core.InputMessage, stage string,
+	attempts int, err error) error {
+	if k.deadLetter == nil {
+		return nil
+	}
+	deadLetterMessage := &core.DeadLetterMessage{
+		Raw:      inputMessage.Raw,
+		Stage:    stage,
+		Err:      err,
+		Attempts: attempts,
+		FailedAt: time.Now(),
+	}
+	_, dlErr := retry(ctx, k.outputRetryPolicy, func() error {
+		return k.deadLetter.SendDeadLetter(ctx, deadLetterMessage)
+	}, noop, noop)
+	if dlErr != nil {
+		fmt.Printf("send dead letter error:%s\n", dlErr.Error())
+	}
+	return dlErr
+}
+
+// commitMessage commits the highest contiguous acked offset of every partition
+// whenever a message is acked.
 func (k *KQ) commitMessage(ctx context.Context) error {
-	ticket := time.Tick(time.Millisecond * 500)
-	for k.kqStatus.Load() == kqStatusRunning {
+	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticket:
-			runtime.Gosched()
-		case commitMessage := <-k.commitMessageChanel:
-			commitMessage.Lock()
-			err := k.input.CommitMessage(ctx, commitMessage)
-			if err != nil {
-				commitMessage.Release()
-				continue
-			}
-			commitMessage.Release()
+		case <-k.offsetTracker.notify:
+			k.commitOffsets(ctx)
 		}
 	}
-	return nil
 }
 
+func (k *KQ) commitOffsets(ctx context.Context) {
+	commits, done := k.offsetTracker.collect()
+	for _, commitMessage := range commits {
+		if err := k.input.CommitMessage(ctx, commitMessage); err != nil {
+			fmt.Printf("commit message error:%s\n", err.Error())
+		}
+	}
+	for _, m := range done {
+		m.Release()
+	}
+}
+
+// Close stops pulling from the input and waits, bounded by ctx, until every in-flight message
+// has reached the output and its offset has been committed. The input and the output are
+// closed afterwards and all errors met on the way are returned together.
 func (k *KQ) Close(ctx context.Context) error {
-	k.kqStatus.Store(kqStatusClosed)
-	return nil
+	var batchErr errorx.BatchError
+	if k.kqStatus.CompareAndSwap(kqStatusRunning, kqStatusClosed) {
+		batchErr.Add(k.drain(ctx))
+	} else if !k.kqStatus.CompareAndSwap(kqStatusInit, kqStatusClosed) {
+		return nil
+	}
+	if k.input != nil {
+		batchErr.Add(k.input.Close(ctx))
+	}
+	if k.output != nil {
+		batchErr.Add(k.output.Close(ctx))
+	}
+	if k.deadLetter != nil {
+		batchErr.Add(k.deadLetter.Close(ctx))
+	}
+	return batchErr.Err()
+}
+
+func (k *KQ) drain(ctx context.Context) error {
+	var err error
+	k.stopInput()
+	select {
+	case <-k.inputDone:
+		if k.aggregator != nil {
+			err = k.flushAggregator(ctx)
+		}
+		if err == nil {
+			select {
+			case <-k.offsetTracker.idle():
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	k.cancel()
+	k.loops.Wait()
+	if k.transaction == nil {
+		k.commitOffsets(ctx)
+	}
+	return err
 }
 
 type internalMessage struct {
-	inputMessage     *core.InputMessage
-	extractorMessage core.Message
-	outPutMessage    *core.OutputMessage
+	core.StageMessage
+	// inputs are the held messages of an aggregate, which has no Input.
+	inputs []core.Message
 }
 
 func getInternalMessage() *internalMessage {
@@ -1,5 +1,11 @@
 package kq
 
+import (
+	"time"
+
+	"github.com/colinrs/pkgx/kq/metrics"
+)
+
 const (
 	defaultInputMessageChannelSize     = 1000
 	defaultMaxGoroutines               = 10000
@@ -14,6 +20,16 @@ type options struct {
 	commitMessageChannelSize    int
 	extractorMessageChannelSize int
 	outPutMessageChannelSize    int
+	transformerRetryPolicy      *RetryPolicy
+	outputRetryPolicy           *RetryPolicy
+	lanes                       int
+	keyFunc                     KeyFunc
+	batchOptions                *BatchOptions
+	metricsSink                 metrics.Sink
+	metricsInterval             time.Duration
+	backpressureOptions         *BackpressureOptions
+	inputErrorHandler           func(err error)
+	transactionOptions          *TransactionOptions
 }
 
 type Option func(*options)
@@ -32,6 +48,8 @@ func WithInputMessageChannelSize(inputMessageChannelSize int) Option {
 	}
 }
 
+// WithCommitMessageChannelSize
+// Deprecated: offsets are tracked per topic-partition and committed without a channel.
 func WithCommitMessageChannelSize(commitMessageChannelSize int) Option {
 	return func(o *options) {
 		o.commitMessageChannelSize = commitMessageChannelSize
@@ -55,3 +73,95 @@ func WithOutPutMessageChannelSize(outPutMessageChannelSize int) Option {
 		o.outPutMessageChannelSize = outPutMessageChannelSize
 	}
 }
+
+// WithTransformerRetryPolicy retries failed Transformer.Process calls according to policy
+func WithTransformerRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.transformerRetryPolicy = &policy
+	}
+}
+
+// WithOutputRetryPolicy retries failed Output.SendOutput calls according to policy
+func WithOutputRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.outputRetryPolicy = &policy
+	}
+}
+
+// WithKeyOrdered processes messages sharing a key in order on one of lanes workers,
+// the record key is used unless WithKeyFunc is set
+func WithKeyOrdered(lanes int) Option {
+	return func(o *options) {
+		o.lanes = lanes
+	}
+}
+
+// WithKeyFunc sets the ordering key used in key-ordered mode
+func WithKeyFunc(keyFunc KeyFunc) Option {
+	return func(o *options) {
+		o.keyFunc = keyFunc
+	}
+}
+
+// WithBatch groups output messages and sends them together when the output implements core.BatchOutput,
+// messages are acked once their batch has been sent
+func WithBatch(batchOptions BatchOptions) Option {
+	return func(o *options) {
+		if batchOptions.MaxSize <= 0 {
+			batchOptions.MaxSize = defaultBatchMaxSize
+		}
+		if batchOptions.Linger <= 0 {
+			batchOptions.Linger = defaultBatchLinger
+		}
+		o.batchOptions = &batchOptions
+	}
+}
+
+// WithMetrics reports throughput, stage latencies and errors to sink as they happen,
+// and the channel, goroutine and partition gauges of KQ.Stats every interval, 10s when 0
+func WithMetrics(sink metrics.Sink, interval time.Duration) Option {
+	return func(o *options) {
+		o.metricsSink = sink
+		if interval > 0 {
+			o.metricsInterval = interval
+		}
+	}
+}
+
+// WithBackpressure pauses the input when the in-flight messages or the stage latency cross the
+// high watermarks and resumes it once the in-flight messages drop to the low watermark.
+func WithBackpressure(backpressureOptions BackpressureOptions) Option {
+	return func(o *options) {
+		if backpressureOptions.LowInFlight <= 0 ||
+			(backpressureOptions.HighInFlight > 0 && backpressureOptions.LowInFlight >= backpressureOptions.HighInFlight) {
+			backpressureOptions.LowInFlight = backpressureOptions.HighInFlight / 2
+		}
+		if backpressureOptions.CheckInterval <= 0 {
+			backpressureOptions.CheckInterval = defaultBackpressureCheckInterval
+		}
+		o.backpressureOptions = &backpressureOptions
+	}
+}
+
+// WithInputErrorHandler receives the errors returned by core.Input.Consumer, kq retries after a backoff
+func WithInputErrorHandler(inputErrorHandler func(err error)) Option {
+	return func(o *options) {
+		if inputErrorHandler != nil {
+			o.inputErrorHandler = inputErrorHandler
+		}
+	}
+}
+
+// WithExactlyOnce commits the outputs and the input offsets together in transactions,
+// the output must implement core.TransactionalOutput and the input core.Rewinder
+func WithExactlyOnce(transactionOptions TransactionOptions) Option {
+	return func(o *options) {
+		if transactionOptions.MaxMessages <= 0 {
+			transactionOptions.MaxMessages = defaultTransactionMaxMessages
+		}
+		if transactionOptions.Interval <= 0 {
+			transactionOptions.Interval = defaultTransactionInterval
+		}
+		o.transactionOptions = &transactionOptions
+	}
+}
@@ -0,0 +1,343 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/deadletter/memory"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type testInput struct {
+	messages chan *sarama.ConsumerMessage
+
+	mu        sync.Mutex
+	committed map[int32]int64
+	closed    bool
+}
+
+func newTestInput(partitions int32, count int) *testInput {
+	in := &testInput{
+		messages:  make(chan *sarama.ConsumerMessage, count),
+		committed: make(map[int32]int64),
+	}
+	for i := 0; i < count; i++ {
+		in.messages <- &sarama.ConsumerMessage{
+			Topic:     "test",
+			Partition: int32(i) % partitions,
+			Offset:    int64(i) / int64(partitions),
+			Value:     []byte(fmt.Sprintf("%d", i)),
+		}
+	}
+	return in
+}
+
+func (in *testInput) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case raw := <-in.messages:
+		m := core.NewInputMessage()
+		m.Raw = raw
+		return m, nil
+	}
+}
+
+func (in *testInput) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.committed[inputMessage.Raw.Partition] = inputMessage.Raw.Offset
+	return nil
+}
+
+func (in *testInput) Close(ctx context.Context) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.closed = true
+	return nil
+}
+
+type testMessage struct {
+	id  string
+	ctx context.Context
+}
+
+func (m *testMessage) ID() string           { return m.id }
+func (m *testMessage) Timestamp() time.Time { return time.Time{} }
+func (m *testMessage) Ctx() context.Context { return m.ctx }
+
+type testExtractor struct{}
+
+func (e *testExtractor) Unmarshal(ctx context.Context, message *core.InputMessage) (core.Message, error) {
+	return &testMessage{id: string(message.Raw.Value), ctx: ctx}, nil
+}
+
+func (e *testExtractor) OnDone(ctx context.Context, message *core.InputMessage) {}
+
+func (e *testExtractor) OnError(ctx context.Context, message *core.InputMessage, err error) {}
+
+type testTransformer struct {
+	delay time.Duration
+}
+
+func (t *testTransformer) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	time.Sleep(t.delay)
+	return &core.OutputMessage{Ctx: message.Ctx(), Data: message.ID()}, nil
+}
+
+func (t *testTransformer) OnDone(ctx context.Context, message core.Message) {}
+
+func (t *testTransformer) OnError(ctx context.Context, message core.Message, err error) {}
+
+type testOutput struct {
+	mu       sync.Mutex
+	received []interface{}
+	closeErr error
+}
+
+func (o *testOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.received = append(o.received, message.Data)
+	return nil
+}
+
+func (o *testOutput) OnDone(ctx context.Context, message *core.OutputMessage) {}
+
+func (o *testOutput) OnError(ctx context.Context, message *core.OutputMessage, err error) {}
+
+func (o *testOutput) Close(ctx context.Context) error {
+	return o.closeErr
+}
+
+func (o *testOutput) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.received)
+}
+
+func newTestKQ(ctx context.Context, input core.Input, transformer core.Transformer, output core.Output,
+	opts ...Option) *KQ {
+	return NewKQ(ctx, opts...).
+		SetInput(ctx, input).
+		SetExtractor(ctx, &testExtractor{}).
+		SetTransformer(ctx, transformer).
+		SetOutput(ctx, output)
+}
+
+func TestKQCloseDrains(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(2, 100)
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{delay: time.Millisecond}, output)
+	a.NoError(k.Run(ctx))
+	for output.count() < 10 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	a.NoError(k.Close(closeCtx))
+
+	received := output.count()
+	a.Equal(100-len(input.messages), received)
+	a.True(input.closed)
+	committed := 0
+	for _, offset := range input.committed {
+		committed += int(offset) + 1
+	}
+	a.Equal(received, committed)
+}
+
+func TestKQCloseAggregatesErrors(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	closeErr := errors.New("output close")
+	k := newTestKQ(ctx, newTestInput(1, 0), &testTransformer{}, &testOutput{closeErr: closeErr})
+	a.NoError(k.Run(ctx))
+	a.ErrorIs(k.Close(ctx), closeErr)
+	a.NoError(k.Close(ctx))
+}
+
+type failingTransformer struct {
+	err error
+}
+
+func (t *failingTransformer) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	return nil, t.err
+}
+
+func (t *failingTransformer) OnDone(ctx context.Context, message core.Message) {}
+
+func (t *failingTransformer) OnError(ctx context.Context, message core.Message, err error) {}
+
+func TestKQDeadLetter(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	processErr := errors.New("process")
+	deadLetter := memory.NewDeadLetter()
+	input := newTestInput(1, 3)
+	k := newTestKQ(ctx, input, &failingTransformer{err: processErr}, &testOutput{}).
+		SetDeadLetter(ctx, deadLetter)
+	a.NoError(k.Run(ctx))
+	for len(deadLetter.Messages()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	for _, m := range deadLetter.Messages() {
+		a.Equal(core.StageTransformer, m.Stage)
+		a.ErrorIs(m.Err, processErr)
+		a.Equal(1, m.Attempts)
+		a.NotNil(m.Raw)
+	}
+	a.Equal(int64(2), input.committed[0])
+}
+
+type failingDeadLetter struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []*core.DeadLetterMessage
+}
+
+func (d *failingDeadLetter) SendDeadLetter(ctx context.Context, message *core.DeadLetterMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls++
+	if d.failures < 0 || d.calls <= d.failures {
+		return errors.New("dead letter")
+	}
+	d.sent = append(d.sent, message)
+	return nil
+}
+
+func (d *failingDeadLetter) Close(ctx context.Context) error { return nil }
+
+func (d *failingDeadLetter) count() (calls, sent int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls, len(d.sent)
+}
+
+func TestKQDeadLetterFailure(t *testing.T) {
+	ctx := context.Background()
+	retryPolicy := WithOutputRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	t.Run("retried", func(t *testing.T) {
+		a := assert.New(t)
+		deadLetter := &failingDeadLetter{failures: 2}
+		input := newTestInput(1, 3)
+		k := newTestKQ(ctx, input, &failingTransformer{err: errors.New("process")}, &testOutput{}, retryPolicy).
+			SetDeadLetter(ctx, deadLetter)
+		a.NoError(k.Run(ctx))
+		for _, sent := deadLetter.count(); sent < 3; _, sent = deadLetter.count() {
+			time.Sleep(time.Millisecond)
+		}
+		a.NoError(k.Close(ctx))
+		a.Equal(int64(2), input.committed[0])
+	})
+
+	t.Run("left unacked", func(t *testing.T) {
+		a := assert.New(t)
+		deadLetter := &failingDeadLetter{failures: -1}
+		input := newTestInput(1, 3)
+		k := newTestKQ(ctx, input, &failingTransformer{err: errors.New("process")}, &testOutput{}, retryPolicy).
+			SetDeadLetter(ctx, deadLetter)
+		a.NoError(k.Run(ctx))
+		for calls, _ := deadLetter.count(); calls < 9; calls, _ = deadLetter.count() {
+			time.Sleep(time.Millisecond)
+		}
+		closed := make(chan error, 1)
+		go func() {
+			closed <- k.Close(ctx)
+		}()
+		select {
+		case err := <-closed:
+			a.NoError(err)
+		case <-time.After(time.Second):
+			a.Fail("Close without a deadline waits for the messages left unacked")
+		}
+		a.Empty(input.committed)
+	})
+}
+
+func TestKQMiddlewareDrop(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 10)
+	output := &testOutput{}
+	dropOdd := func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			if message.Stage == core.StageTransformer && message.Message.ID()[0]%2 == 1 {
+				return nil
+			}
+			return next(ctx, message)
+		}
+	}
+	k := newTestKQ(ctx, input, &testTransformer{}, output).SetMiddleware(ctx, dropOdd)
+	a.NoError(k.Run(ctx))
+	for {
+		input.mu.Lock()
+		committed := input.committed[0]
+		input.mu.Unlock()
+		if committed == 9 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	a.ElementsMatch([]interface{}{"0", "2", "4", "6", "8"}, output.received)
+}
+
+// fanOutTransformer emits two children per message and drops message "0".
+type fanOutTransformer struct{}
+
+func (t *fanOutTransformer) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	if message.ID() == "0" {
+		return &core.OutputMessage{Children: []*core.OutputMessage{}}, nil
+	}
+	return &core.OutputMessage{Children: []*core.OutputMessage{
+		{Ctx: message.Ctx(), Data: message.ID() + "a"},
+		{Ctx: message.Ctx(), Data: message.ID() + "b"},
+	}}, nil
+}
+
+func (t *fanOutTransformer) OnDone(ctx context.Context, message core.Message) {}
+
+func (t *fanOutTransformer) OnError(ctx context.Context, message core.Message, err error) {}
+
+func TestKQFanOut(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := newTestInput(1, 3)
+	output := &flakyOutput{failures: map[interface{}]int{"1b": 1}, err: errTransient}
+	k := newTestKQ(ctx, input, &fanOutTransformer{}, output,
+		WithOutputRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	a.ElementsMatch([]interface{}{"1a", "1b", "2a", "2b"}, output.received)
+	a.Equal(int64(2), input.committed[0])
+
+	batchOutput := &testBatchOutput{}
+	k = newTestKQ(ctx, newTestInput(1, 3), &fanOutTransformer{}, batchOutput,
+		WithBatch(BatchOptions{MaxSize: 1}))
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+	a.ElementsMatch([]interface{}{"1a", "1b", "2a", "2b"}, batchOutput.received)
+	a.Equal([]int{2, 2}, batchOutput.batches)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"expvar"
+)
+
+// Snapshot returns every metric keyed by name then by its labels, as published through expvar.
+// Counters and gauges map to their value, histograms to their count, sum and bucket counts.
+func (r *Registry) Snapshot() map[string]map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snapshot := make(map[string]map[string]interface{}, len(r.families))
+	for _, f := range r.sortedFamilies() {
+		values := make(map[string]interface{}, len(f.series))
+		for _, s := range f.sortedSeries() {
+			key := labelsKey(s.labels)
+			if f.kind != kindHistogram {
+				values[key] = s.value
+				continue
+			}
+			buckets := make(map[string]uint64, len(r.buckets))
+			for i, upper := range r.buckets {
+				buckets[formatFloat(upper)] = s.counts[i]
+			}
+			values[key] = map[string]interface{}{
+				"count":   s.count,
+				"sum":     s.sum,
+				"buckets": buckets,
+			}
+		}
+		snapshot[f.name] = values
+	}
+	return snapshot
+}
+
+// PublishExpvar publishes the registry under name in expvar, it panics if name is already used.
+func (r *Registry) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return r.Snapshot()
+	}))
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultBuckets are the histogram upper bounds used by the Registry, in seconds.
+	DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Labels qualify a metric, e.g. {"stage": "output"}.
+type Labels map[string]string
+
+// Sink receives the metrics of a kq pipeline.
+type Sink interface {
+	AddCounter(name string, labels Labels, delta float64)
+	SetGauge(name string, labels Labels, value float64)
+	ObserveHistogram(name string, labels Labels, value float64)
+}
+
+type metricKind int
+
+const (
+	kindCounter metricKind = iota
+	kindGauge
+	kindHistogram
+)
+
+type series struct {
+	labels Labels
+	value  float64
+	// histogram only
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type family struct {
+	name   string
+	kind   metricKind
+	series map[string]*series
+}
+
+// Registry is an in-memory Sink which can be exported as Prometheus text or through expvar.
+type Registry struct {
+	mu       sync.RWMutex
+	buckets  []float64
+	families map[string]*family
+}
+
+// NewRegistry returns a Registry, histograms use buckets or DefaultBuckets when empty.
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Registry{
+		buckets:  sorted,
+		families: make(map[string]*family),
+	}
+}
+
+func (r *Registry) AddCounter(name string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, kindCounter, labels).value += delta
+}
+
+func (r *Registry) SetGauge(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, kindGauge, labels).value = value
+}
+
+func (r *Registry) ObserveHistogram(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, kindHistogram, labels)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(r.buckets))
+	}
+	for i, upper := range r.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// series must be called with the lock held.
+func (r *Registry) series(name string, kind metricKind, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, kind: kind, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := labelsKey(labels)
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{labels: copied}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sortedFamilies must be called with the read lock held.
+func (r *Registry) sortedFamilies() []*family {
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	return families
+}
+
+func (f *family) sortedSeries() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		series = append(series, f.series[key])
+	}
+	return series
+}
+
+func labelsKey(labels Labels) string {
+	names := sortedNames(labels)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func sortedNames(labels Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
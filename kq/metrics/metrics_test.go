@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryPrometheus(t *testing.T) {
+	a := assert.New(t)
+	r := NewRegistry(0.1, 1)
+	r.AddCounter("kq_total", nil, 2)
+	r.AddCounter("kq_total", nil, 1)
+	r.SetGauge("kq_lag", Labels{"topic": "t", "partition": "0"}, 5)
+	r.ObserveHistogram("kq_seconds", Labels{"stage": "output"}, 0.05)
+	r.ObserveHistogram("kq_seconds", Labels{"stage": "output"}, 0.5)
+
+	buf := &bytes.Buffer{}
+	a.NoError(r.WritePrometheus(buf))
+	a.Equal(`# TYPE kq_lag gauge
+kq_lag{partition="0",topic="t"} 5
+# TYPE kq_seconds histogram
+kq_seconds_bucket{stage="output",le="0.1"} 1
+kq_seconds_bucket{stage="output",le="1"} 2
+kq_seconds_bucket{stage="output",le="+Inf"} 2
+kq_seconds_sum{stage="output"} 0.55
+kq_seconds_count{stage="output"} 2
+# TYPE kq_total counter
+kq_total 3
+`, buf.String())
+
+	snapshot := r.Snapshot()
+	a.Equal(3.0, snapshot["kq_total"][""])
+	a.Equal(5.0, snapshot["kq_lag"]["partition=0,topic=t,"])
+}
+
+func TestRegistryPrometheusEscaping(t *testing.T) {
+	a := assert.New(t)
+	r := NewRegistry()
+	r.SetGauge("kq_lag", Labels{"topic": "a\\b\"c\nd\té"}, 1)
+	buf := &bytes.Buffer{}
+	a.NoError(r.WritePrometheus(buf))
+	a.Equal("# TYPE kq_lag gauge\nkq_lag{topic=\"a\\\\b\\\"c\\nd\té\"} 1\n", buf.String(),
+		"only backslash, double quote and line feed are escaped")
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	// labelValueEscaper escapes a label value as the text format expects, other characters are kept as is.
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// WritePrometheus writes every metric in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	r.mu.RLock()
+	for _, f := range r.sortedFamilies() {
+		switch f.kind {
+		case kindCounter:
+			fmt.Fprintf(bw, "# TYPE %s counter\n", f.name)
+		case kindGauge:
+			fmt.Fprintf(bw, "# TYPE %s gauge\n", f.name)
+		case kindHistogram:
+			fmt.Fprintf(bw, "# TYPE %s histogram\n", f.name)
+		}
+		for _, s := range f.sortedSeries() {
+			if f.kind != kindHistogram {
+				fmt.Fprintf(bw, "%s%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.value))
+				continue
+			}
+			for i, upper := range r.buckets {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", formatFloat(upper)), s.counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", f.name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", f.name, formatLabels(s.labels, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", f.name, formatLabels(s.labels, "", ""), s.count)
+		}
+	}
+	r.mu.RUnlock()
+	return bw.Flush()
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WritePrometheus(w)
+	})
+}
+
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)+1)
+	for _, name := range sortedNames(labels) {
+		pairs = append(pairs, name+`="`+labelValueEscaper.Replace(labels[name])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelValueEscaper.Replace(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
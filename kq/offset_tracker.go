@@ -0,0 +1,211 @@
+package kq
+
+import (
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+func topicPartitionOf(m *core.InputMessage) topicPartition {
+	if m.Raw == nil {
+		return topicPartition{partition: -1}
+	}
+	return topicPartition{topic: m.Raw.Topic, partition: m.Raw.Partition}
+}
+
+type partitionOffsets struct {
+	messages  []*core.InputMessage
+	consumed  int64
+	committed int64
+	// base is the first offset not committed, the first tracked offset before any commit.
+	base int64
+}
+
+// offsetTracker keeps the in-flight messages of every topic-partition in arrival order.
+// Messages may be acked in any order, but a partition only becomes committable up to
+// the last message of its contiguous acked prefix, so nothing is skipped on restart.
+// A failed message is never acked, it stays tracked and holds back the commits of its partition.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionOffsets
+	inFlight   int
+	notify     chan struct{}
+	empty      chan struct{}
+	// acked counts the in-flight messages acked but not collected yet, they may wait behind
+	// an unacked message of their partition. failed counts the messages given up by fail.
+	acked  int
+	failed int
+}
+
+func newOffsetTracker() *offsetTracker {
+	t := &offsetTracker{
+		partitions: make(map[topicPartition]*partitionOffsets),
+		notify:     make(chan struct{}, 1),
+		empty:      make(chan struct{}),
+	}
+	close(t.empty)
+	return t
+}
+
+// track registers a message which has just been consumed.
+func (t *offsetTracker) track(m *core.InputMessage) {
+	m.OnAck(t.onAck)
+	tp := topicPartitionOf(m)
+	t.mu.Lock()
+	if t.processingLocked() == 0 {
+		t.empty = make(chan struct{})
+	}
+	p, ok := t.partitions[tp]
+	if !ok {
+		p = &partitionOffsets{consumed: -1, committed: -1, base: -1}
+		t.partitions[tp] = p
+	}
+	p.messages = append(p.messages, m)
+	if m.Raw != nil {
+		p.consumed = m.Raw.Offset
+		if p.base < 0 {
+			p.base = m.Raw.Offset
+		}
+	}
+	t.inFlight++
+	t.mu.Unlock()
+}
+
+func (t *offsetTracker) onAck(*core.InputMessage) {
+	t.mu.Lock()
+	t.acked++
+	t.settledLocked()
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// fail gives up a tracked message which is left unacked, it no longer counts as processing.
+func (t *offsetTracker) fail(*core.InputMessage) {
+	t.mu.Lock()
+	t.failed++
+	t.settledLocked()
+	t.mu.Unlock()
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// settledLocked closes empty once no message is processing. The lock must be held.
+func (t *offsetTracker) settledLocked() {
+	if t.processingLocked() == 0 {
+		close(t.empty)
+	}
+}
+
+// collect removes the contiguous acked prefix of every partition.
+// commits holds the last message of each prefix, done holds every removed message.
+func (t *offsetTracker) collect() (commits []*core.InputMessage, done []*core.InputMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.partitions {
+		messages := p.messages
+		n := 0
+		for n < len(messages) && messages[n].Acked() {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		last := messages[n-1]
+		commits = append(commits, last)
+		if last.Raw != nil {
+			p.committed = last.Raw.Offset
+			p.base = last.Raw.Offset + 1
+		}
+		done = append(done, messages[:n]...)
+		for i := 0; i < n; i++ {
+			messages[i] = nil
+		}
+		t.inFlight -= n
+		t.acked -= n
+		p.messages = messages[n:]
+	}
+	return commits, done
+}
+
+// clear forgets every tracked message, e.g. when the input is rewound to the committed offsets.
+// It must only be called once no message is processing.
+func (t *offsetTracker) clear() []*core.InputMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var cleared []*core.InputMessage
+	for _, p := range t.partitions {
+		cleared = append(cleared, p.messages...)
+		p.messages = nil
+	}
+	t.inFlight, t.acked, t.failed = 0, 0, 0
+	return cleared
+}
+
+// pending returns how many tracked messages have not been collected yet.
+func (t *offsetTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.inFlight
+}
+
+// processing returns how many tracked messages have been neither acked nor failed yet.
+func (t *offsetTracker) processing() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.processingLocked()
+}
+
+func (t *offsetTracker) processingLocked() int {
+	return t.inFlight - t.acked - t.failed
+}
+
+// failures returns how many tracked messages have failed.
+func (t *offsetTracker) failures() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
+
+// idle returns a channel which is closed once every tracked message has been acked or failed.
+func (t *offsetTracker) idle() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.empty
+}
+
+// partitionStats returns the offsets of every partition seen so far,
+// highWaterMarks are the ones reported by the input if it is a core.HighWaterMarker.
+func (t *offsetTracker) partitionStats(highWaterMarks map[string]map[int32]int64) []PartitionStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]PartitionStats, 0, len(t.partitions))
+	for tp, p := range t.partitions {
+		stat := PartitionStats{
+			Topic:         tp.topic,
+			Partition:     tp.partition,
+			InFlight:      len(p.messages),
+			Consumed:      p.consumed,
+			Committed:     p.committed,
+			HighWaterMark: -1,
+		}
+		if p.base >= 0 {
+			stat.Lag = p.consumed + 1 - p.base
+			if hwm, ok := highWaterMarks[tp.topic][tp.partition]; ok {
+				stat.HighWaterMark = hwm
+				stat.Lag = hwm - p.base
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
@@ -0,0 +1,122 @@
+package kq
+
+import (
+	"testing"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestInputMessage(topic string, partition int32, offset int64) *core.InputMessage {
+	m := core.NewInputMessage()
+	m.Raw = &sarama.ConsumerMessage{Topic: topic, Partition: partition, Offset: offset}
+	return m
+}
+
+func TestOffsetTrackerContiguousCommit(t *testing.T) {
+	a := assert.New(t)
+	tracker := newOffsetTracker()
+	p0 := []*core.InputMessage{
+		newTestInputMessage("t", 0, 10),
+		newTestInputMessage("t", 0, 11),
+		newTestInputMessage("t", 0, 12),
+	}
+	p1 := newTestInputMessage("t", 1, 5)
+	for _, m := range p0 {
+		tracker.track(m)
+	}
+	tracker.track(p1)
+	a.Equal(4, tracker.pending())
+
+	p0[1].Ack()
+	p0[2].Ack()
+	commits, done := tracker.collect()
+	a.Empty(commits)
+	a.Empty(done)
+
+	p0[0].Ack()
+	p1.Ack()
+	p1.Ack()
+	commits, done = tracker.collect()
+	a.Len(done, 4)
+	a.Len(commits, 2)
+	offsets := map[int32]int64{}
+	for _, m := range commits {
+		offsets[m.Raw.Partition] = m.Raw.Offset
+	}
+	a.Equal(map[int32]int64{0: 12, 1: 5}, offsets)
+	a.Equal(0, tracker.pending())
+}
+
+func TestOffsetTrackerPartialPrefix(t *testing.T) {
+	a := assert.New(t)
+	tracker := newOffsetTracker()
+	messages := []*core.InputMessage{
+		newTestInputMessage("t", 0, 1),
+		newTestInputMessage("t", 0, 2),
+		newTestInputMessage("t", 0, 3),
+	}
+	for _, m := range messages {
+		tracker.track(m)
+	}
+	messages[0].Ack()
+	messages[2].Ack()
+	commits, done := tracker.collect()
+	a.Len(done, 1)
+	a.Equal(int64(1), commits[0].Raw.Offset)
+
+	messages[1].Ack()
+	commits, _ = tracker.collect()
+	a.Equal(int64(3), commits[0].Raw.Offset)
+	a.Equal(0, tracker.pending())
+}
+
+func TestOffsetTrackerFail(t *testing.T) {
+	a := assert.New(t)
+	tracker := newOffsetTracker()
+	messages := []*core.InputMessage{
+		newTestInputMessage("t", 0, 1),
+		newTestInputMessage("t", 0, 2),
+	}
+	for _, m := range messages {
+		tracker.track(m)
+	}
+	tracker.fail(messages[0])
+	messages[1].Ack()
+	<-tracker.idle()
+	commits, done := tracker.collect()
+	a.Empty(commits, "a failed message holds back the commits of its partition")
+	a.Empty(done)
+	a.Equal(2, tracker.pending())
+	a.Equal(0, tracker.processing())
+
+	a.Len(tracker.clear(), 2)
+	a.Equal(0, tracker.pending())
+	a.Equal(0, tracker.failures())
+}
+
+func TestOffsetTrackerLag(t *testing.T) {
+	a := assert.New(t)
+	tracker := newOffsetTracker()
+	messages := []*core.InputMessage{
+		newTestInputMessage("t", 0, 100),
+		newTestInputMessage("t", 0, 101),
+		newTestInputMessage("t", 0, 102),
+	}
+	for _, m := range messages {
+		tracker.track(m)
+	}
+	highWaterMarks := map[string]map[int32]int64{"t": {0: 105}}
+	a.Equal(int64(5), tracker.partitionStats(highWaterMarks)[0].Lag, "the lag starts at the first consumed offset")
+	a.Equal(int64(3), tracker.partitionStats(nil)[0].Lag)
+
+	messages[0].Ack()
+	tracker.collect()
+	stats := tracker.partitionStats(highWaterMarks)[0]
+	a.Equal(int64(100), stats.Committed)
+	a.Equal(int64(105), stats.HighWaterMark)
+	a.Equal(int64(4), stats.Lag)
+	a.Equal(int64(2), tracker.partitionStats(nil)[0].Lag)
+}
@@ -0,0 +1,105 @@
+package kq
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	goSafe "github.com/colinrs/pkgx/fx"
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// KeyFunc returns the ordering key of a message, messages sharing a key are processed in order.
+type KeyFunc func(message core.Message) string
+
+// orderedProcess replaces the extractor, transformer and output loops in key-ordered mode.
+// Messages are extracted in arrival order and hashed by key to a fixed set of lanes,
+// every lane transforms and outputs its messages one after another.
+func (k *KQ) orderedProcess(ctx context.Context) error {
+	lanes := make([]chan *internalMessage, k.lanes)
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	for i := range lanes {
+		lane := make(chan *internalMessage, k.laneChannelSize)
+		lanes[i] = lane
+		wg.Add(1)
+		goSafe.GoSafeWithRecover(func() {
+			k.processLane(ctx, lane)
+		}, kqRecover(orderedLaneEventName, wg.Done))
+	}
+	var next uint32
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case inputMessage, ok := <-k.inputMessageChannel:
+			if !ok {
+				return nil
+			}
+			iMessage := k.extract(ctx, inputMessage)
+			if iMessage == nil {
+				continue
+			}
+			select {
+			case lanes[k.lane(iMessage, &next)] <- iMessage:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (k *KQ) processLane(ctx context.Context, lane chan *internalMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case iMessage := <-lane:
+			k.processOrdered(ctx, iMessage)
+		}
+	}
+}
+
+func (k *KQ) processOrdered(ctx context.Context, iMessage *internalMessage) {
+	k.limitGoroutines.Acquire()
+	defer kqRecover(orderedLaneEventName, k.limitGoroutines.Release)()
+	if k.transform(ctx, iMessage) {
+		k.send(ctx, iMessage)
+	}
+}
+
+// orderedAggregate replaces the output loop for the aggregates in key-ordered mode, they are sent
+// one after another in the order they were emitted, taking a slot of the shared limit like the lanes.
+func (k *KQ) orderedAggregate(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case iMessage := <-k.outPutMessageChanel:
+			k.sendOrdered(ctx, iMessage)
+		}
+	}
+}
+
+func (k *KQ) sendOrdered(ctx context.Context, iMessage *internalMessage) {
+	k.limitGoroutines.Acquire()
+	defer kqRecover(orderedAggregateEventName, k.limitGoroutines.Release)()
+	k.send(ctx, iMessage)
+}
+
+// lane hashes the message key, messages without a key are spread round-robin.
+func (k *KQ) lane(iMessage *internalMessage, next *uint32) int {
+	var key string
+	if k.keyFunc != nil {
+		key = k.keyFunc(iMessage.Message)
+	} else if raw := iMessage.Input.Raw; raw != nil {
+		key = string(raw.Key)
+	}
+	if key == "" {
+		*next++
+		return int(*next % uint32(k.lanes))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(k.lanes))
+}
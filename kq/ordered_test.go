@@ -0,0 +1,54 @@
+package kq
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type jitterTransformer struct {
+	testTransformer
+}
+
+func (t *jitterTransformer) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	return t.testTransformer.Process(ctx, message)
+}
+
+func TestKQKeyOrdered(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	const count, keys = 200, 5
+	keyOf := func(id string) string {
+		i, _ := strconv.Atoi(id)
+		return strconv.Itoa(i % keys)
+	}
+	output := &testOutput{}
+	k := newTestKQ(ctx, newTestInput(1, count), &jitterTransformer{}, output,
+		WithKeyOrdered(3),
+		WithKeyFunc(func(message core.Message) string {
+			return keyOf(message.ID())
+		}))
+	a.NoError(k.Run(ctx))
+	for output.count() < count {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	last := map[string]int{}
+	for _, data := range output.received {
+		i, _ := strconv.Atoi(data.(string))
+		key := keyOf(data.(string))
+		if prev, ok := last[key]; ok {
+			a.Less(prev, i, "key %s out of order", key)
+		}
+		last[key] = i
+	}
+	a.Len(last, keys)
+}
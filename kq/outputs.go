@@ -0,0 +1,273 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	goSafe "github.com/colinrs/pkgx/fx"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/zeromicro/go-zero/core/errorx"
+)
+
+// AckPolicy decides when a message sent to several outputs counts as sent,
+// its input message is acked only then, or once it failed for good.
+type AckPolicy string
+
+const (
+	// AckAll needs every output to succeed, a retry only sends to the outputs which failed.
+	AckAll AckPolicy = "all"
+	// AckAny needs at least one output to succeed.
+	AckAny AckPolicy = "any"
+	// AckBestEffort never fails, the failed outputs only get their OnError call.
+	AckBestEffort AckPolicy = "best_effort"
+)
+
+func (p AckPolicy) valid() bool {
+	switch p {
+	case AckAll, AckAny, AckBestEffort:
+		return true
+	}
+	return false
+}
+
+var (
+	_ core.BatchOutput = (*multiOutput)(nil)
+	_ forgetter        = (*multiOutput)(nil)
+)
+
+// forgetter is implemented by outputs keeping the state of a message until its OnDone or OnError call,
+// kq calls forget once it is done with the message, whether or not one of them was called.
+type forgetter interface {
+	forget(messages []*core.OutputMessage)
+}
+
+// errNotSent is the result of a send which did not return, e.g. because the output panicked.
+var errNotSent = errors.New("kq: output not sent")
+
+// multiOutput sends every message to all its outputs in parallel
+// and remembers which of them succeeded until the message is done.
+type multiOutput struct {
+	policy  AckPolicy
+	outputs []core.Output
+
+	mu      sync.Mutex
+	results map[*core.OutputMessage][]outputResult
+}
+
+// outputResult is the outcome of the last attempt to send a message to one of the outputs.
+type outputResult struct {
+	sent bool
+	err  error
+}
+
+// NewMultiOutput returns a core.Output sending every message to all the outputs according to policy,
+// an unknown policy behaves like AckAll.
+func NewMultiOutput(policy AckPolicy, outputs ...core.Output) core.BatchOutput {
+	if !policy.valid() {
+		policy = AckAll
+	}
+	return &multiOutput{
+		policy:  policy,
+		outputs: outputs,
+		results: make(map[*core.OutputMessage][]outputResult),
+	}
+}
+
+// SetOutputs sends every output message to all the outputs, see AckPolicy.
+func (k *KQ) SetOutputs(ctx context.Context, policy AckPolicy, outputs ...core.Output) *KQ {
+	return k.SetOutput(ctx, NewMultiOutput(policy, outputs...))
+}
+
+func (m *multiOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	return m.SendOutputs(ctx, []*core.OutputMessage{message})
+}
+
+func (m *multiOutput) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	pending := make([][]*core.OutputMessage, len(m.outputs))
+	m.mu.Lock()
+	for _, message := range messages {
+		results, ok := m.results[message]
+		if !ok {
+			results = make([]outputResult, len(m.outputs))
+			m.results[message] = results
+		}
+		for i := range results {
+			if !results[i].sent {
+				results[i].err = errNotSent
+				pending[i] = append(pending[i], message)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	sends := make([]func(), 0, len(m.outputs))
+	for i := range m.outputs {
+		if len(pending[i]) == 0 {
+			continue
+		}
+		i := i
+		sends = append(sends, func() {
+			m.send(ctx, i, pending[i])
+		})
+	}
+	goSafe.Parallel(sends...)
+	return m.check(messages)
+}
+
+// send sends messages to the i-th output and records the result of every message,
+// a core.PartialError only fails the messages it lists.
+func (m *multiOutput) send(ctx context.Context, i int, messages []*core.OutputMessage) {
+	output := m.outputs[i]
+	if batchOutput, ok := output.(core.BatchOutput); ok {
+		err := batchOutput.SendOutputs(ctx, messages)
+		var partialErr *core.PartialError
+		if !errors.As(err, &partialErr) {
+			for _, message := range messages {
+				m.record(message, i, err)
+			}
+			return
+		}
+		failed := make(map[*core.OutputMessage]bool, len(partialErr.Failed))
+		for _, message := range partialErr.Failed {
+			failed[message] = true
+		}
+		for _, message := range messages {
+			if failed[message] {
+				m.record(message, i, partialErr.Err)
+			} else {
+				m.record(message, i, nil)
+			}
+		}
+		return
+	}
+	for _, message := range messages {
+		m.record(message, i, output.SendOutput(ctx, message))
+	}
+}
+
+func (m *multiOutput) record(message *core.OutputMessage, i int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.results[message][i] = outputResult{sent: err == nil, err: err}
+}
+
+// check returns the errors of the outputs which keep messages from satisfying the policy,
+// as a core.PartialError listing those messages when the others satisfy it.
+func (m *multiOutput) check(messages []*core.OutputMessage) error {
+	if m.policy == AckBestEffort {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var failedMessages []*core.OutputMessage
+	failed := make([]error, len(m.outputs))
+	for _, message := range messages {
+		results := m.results[message]
+		sent := 0
+		for _, result := range results {
+			if result.sent {
+				sent++
+			}
+		}
+		if (m.policy == AckAny && sent > 0) || sent == len(results) {
+			continue
+		}
+		failedMessages = append(failedMessages, message)
+		for i, result := range results {
+			if !result.sent && failed[i] == nil {
+				failed[i] = result.err
+			}
+		}
+	}
+	if len(failedMessages) == 0 {
+		return nil
+	}
+	var errs outputErrors
+	for _, err := range failed {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var err error = errs
+	if len(errs) == 1 {
+		err = errs[0]
+	}
+	if len(failedMessages) < len(messages) {
+		return &core.PartialError{Failed: failedMessages, Err: err}
+	}
+	return err
+}
+
+// outputErrors holds the errors of several outputs, errors.Is matches any of them
+// so retry policies can still classify them.
+type outputErrors []error
+
+func (e outputErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e outputErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnDone calls OnDone on the outputs which received the message and OnError on the others.
+func (m *multiOutput) OnDone(cxt context.Context, message *core.OutputMessage) {
+	m.done(cxt, message, nil)
+}
+
+// OnError calls OnDone on the outputs which received the message anyway and OnError on the others.
+func (m *multiOutput) OnError(cxt context.Context, message *core.OutputMessage, err error) {
+	m.done(cxt, message, err)
+}
+
+func (m *multiOutput) done(ctx context.Context, message *core.OutputMessage, err error) {
+	m.mu.Lock()
+	results := m.results[message]
+	delete(m.results, message)
+	m.mu.Unlock()
+	for i, output := range m.outputs {
+		var result outputResult
+		if results != nil {
+			result = results[i]
+		}
+		switch {
+		case result.sent:
+			output.OnDone(ctx, message)
+		case result.err != nil:
+			output.OnError(ctx, message, result.err)
+		case err != nil:
+			output.OnError(ctx, message, err)
+		default:
+			output.OnDone(ctx, message)
+		}
+	}
+}
+
+// forget drops the results of messages abandoned without OnDone or OnError, e.g. on a panic.
+func (m *multiOutput) forget(messages []*core.OutputMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, message := range messages {
+		delete(m.results, message)
+	}
+}
+
+func (m *multiOutput) Close(ctx context.Context) error {
+	var batchErr errorx.BatchError
+	for _, output := range m.outputs {
+		batchErr.Add(output.Close(ctx))
+	}
+	return batchErr.Err()
+}
@@ -0,0 +1,156 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/deadletter/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reportingOutput counts the OnDone and OnError calls of a flakyOutput.
+type reportingOutput struct {
+	flakyOutput
+	reportMu sync.Mutex
+	done     int
+	errs     []error
+}
+
+func newReportingOutput(failures map[interface{}]int) *reportingOutput {
+	return &reportingOutput{flakyOutput: flakyOutput{failures: failures, err: errTransient}}
+}
+
+func (o *reportingOutput) OnDone(ctx context.Context, message *core.OutputMessage) {
+	o.reportMu.Lock()
+	defer o.reportMu.Unlock()
+	o.done++
+}
+
+func (o *reportingOutput) OnError(ctx context.Context, message *core.OutputMessage, err error) {
+	o.reportMu.Lock()
+	defer o.reportMu.Unlock()
+	o.errs = append(o.errs, err)
+}
+
+func (o *reportingOutput) reports() (int, int) {
+	o.reportMu.Lock()
+	defer o.reportMu.Unlock()
+	return o.done, len(o.errs)
+}
+
+func TestMultiOutputPolicies(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		policy    AckPolicy
+		failures  []int
+		expectErr bool
+	}{
+		{policy: AckAll, failures: []int{0, 0}},
+		{policy: AckAll, failures: []int{0, 1}, expectErr: true},
+		{policy: AckAny, failures: []int{0, 1}},
+		{policy: AckAny, failures: []int{1, 1}, expectErr: true},
+		{policy: AckBestEffort, failures: []int{1, 1}},
+		{policy: "unknown", failures: []int{1, 0}, expectErr: true},
+	} {
+		a := assert.New(t)
+		outputs := []*reportingOutput{
+			newReportingOutput(map[interface{}]int{"m": c.failures[0]}),
+			newReportingOutput(map[interface{}]int{"m": c.failures[1]}),
+		}
+		output := NewMultiOutput(c.policy, outputs[0], outputs[1])
+		message := &core.OutputMessage{Data: "m"}
+		err := output.SendOutput(ctx, message)
+		if c.expectErr {
+			a.ErrorIs(err, errTransient, c.policy)
+			output.OnError(ctx, message, err)
+		} else {
+			a.NoError(err, c.policy)
+			output.OnDone(ctx, message)
+		}
+		for i, o := range outputs {
+			done, errs := o.reports()
+			a.Equal(1-c.failures[i], done, c.policy)
+			a.Equal(c.failures[i], errs, c.policy)
+		}
+	}
+}
+
+func TestMultiOutputBatchPartialFailure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	partial := &partialBatchOutput{sends: make(map[string]int)}
+	flaky := newReportingOutput(map[interface{}]int{"2": 1})
+	output := NewMultiOutput(AckAll, partial, flaky)
+	messages := []*core.OutputMessage{{Data: "0"}, {Data: "1"}, {Data: "2"}, {Data: "3"}}
+	err := output.SendOutputs(ctx, messages)
+	var partialErr *core.PartialError
+	a.ErrorAs(err, &partialErr)
+	a.Equal([]*core.OutputMessage{messages[1], messages[2], messages[3]}, partialErr.Failed)
+	a.ErrorIs(err, errTransient)
+
+	a.NoError(output.SendOutputs(ctx, partialErr.Failed))
+	a.Equal(map[string]int{"0": 1, "1": 2, "2": 1, "3": 2}, partial.sends, "the retry skips the messages the output sent")
+	a.ElementsMatch([]interface{}{"0", "1", "2", "3"}, flaky.received)
+}
+
+func TestKQSetOutputs(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	stable := newReportingOutput(nil)
+	flaky := newReportingOutput(map[interface{}]int{"0": 1, "1": 5})
+	deadLetter := memory.NewDeadLetter()
+	k := NewKQ(ctx, WithMaxGoroutines(1), WithOutputRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})).
+		SetInput(ctx, newTestInput(1, 3)).
+		SetExtractor(ctx, &testExtractor{}).
+		SetTransformer(ctx, &testTransformer{}).
+		SetOutputs(ctx, AckAll, stable, flaky).
+		SetDeadLetter(ctx, deadLetter)
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	a.ElementsMatch([]interface{}{"0", "1", "2"}, stable.received, "retries skip the outputs which succeeded")
+	a.ElementsMatch([]interface{}{"0", "2"}, flaky.received)
+	deadLetters := deadLetter.Messages()
+	a.Len(deadLetters, 1)
+	a.Equal("1", string(deadLetters[0].Raw.Value))
+	done, errs := stable.reports()
+	a.Equal(3, done)
+	a.Equal(0, errs)
+	done, errs = flaky.reports()
+	a.Equal(2, done)
+	a.Equal(1, errs)
+	a.True(errors.Is(flaky.errs[0], errTransient))
+	output := k.output.(*multiOutput)
+	a.Eventually(func() bool {
+		output.mu.Lock()
+		defer output.mu.Unlock()
+		return len(output.results) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestKQMultiOutputForget(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	k := NewKQ(ctx).SetOutputs(ctx, AckAll, newReportingOutput(nil), newReportingOutput(map[interface{}]int{"m": 1}))
+	output := k.output.(*multiOutput)
+	message := &core.OutputMessage{Children: []*core.OutputMessage{{Data: "m"}, {Data: "n"}}}
+	a.ErrorIs(output.SendOutputs(ctx, message.Outputs()), errTransient)
+	a.Len(output.results, 2)
+
+	// the send is abandoned without OnDone or OnError
+	iMessage := getInternalMessage()
+	iMessage.Output = message
+	k.putBack(iMessage)
+	a.Empty(output.results)
+}
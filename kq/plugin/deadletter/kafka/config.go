@@ -0,0 +1,54 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+// Config is the configuration of the "kafka" dead letter of configured pipelines.
+type Config struct {
+	Brokers  []string `yaml:"brokers" json:"brokers"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	Topic    string   `yaml:"topic" json:"topic"`
+	// Version is the kafka protocol version, e.g. 2.8.0.
+	Version       string `yaml:"version" json:"version"`
+	SASLPlainText bool   `yaml:"sasl_plaintext" json:"sasl_plaintext"`
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, the default.
+	SASLMechanism string              `yaml:"sasl_mechanism" json:"sasl_mechanism"`
+	TLS           pkgxkafka.TLSConfig `yaml:"tls" json:"tls"`
+}
+
+func init() {
+	core.RegisterDeadLetter("kafka", func(ctx context.Context, config core.PluginConfig) (core.DeadLetter, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if len(c.Brokers) == 0 || c.Topic == "" {
+			return nil, errors.New("kafka dead letter: brokers and topic are required")
+		}
+		var opts []Option
+		if c.Version != "" {
+			version, err := sarama.ParseKafkaVersion(c.Version)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithVersion(version))
+		}
+		if c.SASLPlainText {
+			opts = append(opts, WithSASLPlainText())
+		}
+		securityOpts, err := pkgxkafka.SecurityOptions(c.SASLMechanism, &c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKafkaOptions(securityOpts...))
+		return NewDeadLetter(ctx, c.Brokers, c.Username, c.Password, c.Topic, opts...)
+	})
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+var _ core.DeadLetter = (*deadLetter)(nil)
+
+const (
+	HeaderStage     = "kq-dlq-stage"
+	HeaderError     = "kq-dlq-error"
+	HeaderAttempts  = "kq-dlq-attempts"
+	HeaderFailedAt  = "kq-dlq-failed-at"
+	HeaderTopic     = "kq-dlq-topic"
+	HeaderPartition = "kq-dlq-partition"
+	HeaderOffset    = "kq-dlq-offset"
+)
+
+// NewDeadLetter returns a core.DeadLetter which produces failed messages to topic.
+// The original key, value and headers are kept, the failure is described by the kq-dlq-* headers.
+func NewDeadLetter(ctx context.Context, brokers []string, username, password, topic string,
+	opts ...Option) (core.DeadLetter, error) {
+	o := &options{
+		kafkaOptions: []pkgxkafka.Option{pkgxkafka.WithRequiredAcks(sarama.WaitForAll)},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	config := pkgxkafka.NewProducerConfig(username, password, o.kafkaOptions...)
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewDeadLetterWithProducer(producer, topic), nil
+}
+
+// NewDeadLetterWithProducer returns a core.DeadLetter producing to topic through an existing producer,
+// the producer is closed together with the dead letter.
+func NewDeadLetterWithProducer(producer sarama.SyncProducer, topic string) core.DeadLetter {
+	return &deadLetter{producer: producer, topic: topic}
+}
+
+type deadLetter struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func (d *deadLetter) SendDeadLetter(ctx context.Context, message *core.DeadLetterMessage) error {
+	_, _, err := d.producer.SendMessage(d.buildMessage(message))
+	return err
+}
+
+func (d *deadLetter) buildMessage(message *core.DeadLetterMessage) *sarama.ProducerMessage {
+	producerMessage := &sarama.ProducerMessage{Topic: d.topic}
+	headers := []sarama.RecordHeader{
+		header(HeaderStage, message.Stage),
+		header(HeaderAttempts, strconv.Itoa(message.Attempts)),
+		header(HeaderFailedAt, message.FailedAt.Format(time.RFC3339Nano)),
+	}
+	if message.Err != nil {
+		headers = append(headers, header(HeaderError, message.Err.Error()))
+	}
+	if raw := message.Raw; raw != nil {
+		if raw.Key != nil {
+			producerMessage.Key = sarama.ByteEncoder(raw.Key)
+		}
+		if raw.Value != nil {
+			producerMessage.Value = sarama.ByteEncoder(raw.Value)
+		}
+		for _, h := range raw.Headers {
+			if h != nil {
+				headers = append(headers, *h)
+			}
+		}
+		headers = append(headers,
+			header(HeaderTopic, raw.Topic),
+			header(HeaderPartition, strconv.FormatInt(int64(raw.Partition), 10)),
+			header(HeaderOffset, strconv.FormatInt(raw.Offset, 10)),
+		)
+	}
+	producerMessage.Headers = headers
+	return producerMessage
+}
+
+func (d *deadLetter) Close(ctx context.Context) error {
+	return d.producer.Close()
+}
+
+func header(key, value string) sarama.RecordHeader {
+	return sarama.RecordHeader{Key: []byte(key), Value: []byte(value)}
+}
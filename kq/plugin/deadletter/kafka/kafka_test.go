@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func headersOf(msg *sarama.ProducerMessage) map[string]string {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	return headers
+}
+
+func TestDeadLetterSend(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	failedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		a.Equal("dlq", msg.Topic)
+		key, _ := msg.Key.Encode()
+		a.Equal("k", string(key))
+		value, _ := msg.Value.Encode()
+		a.Equal("v", string(value))
+		a.Equal(map[string]string{
+			"trace":         "1",
+			HeaderStage:     "output",
+			HeaderError:     "boom",
+			HeaderAttempts:  "3",
+			HeaderFailedAt:  failedAt.Format(time.RFC3339Nano),
+			HeaderTopic:     "in",
+			HeaderPartition: "2",
+			HeaderOffset:    "7",
+		}, headersOf(msg))
+		return nil
+	})
+	d := NewDeadLetterWithProducer(mock, "dlq")
+	a.NoError(d.SendDeadLetter(ctx, &core.DeadLetterMessage{
+		Raw: &sarama.ConsumerMessage{
+			Topic:     "in",
+			Partition: 2,
+			Offset:    7,
+			Key:       []byte("k"),
+			Value:     []byte("v"),
+			Headers:   []*sarama.RecordHeader{{Key: []byte("trace"), Value: []byte("1")}},
+		},
+		Stage:    "output",
+		Err:      errors.New("boom"),
+		Attempts: 3,
+		FailedAt: failedAt,
+	}))
+	a.NoError(d.Close(ctx))
+}
+
+func TestDeadLetterSendError(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	sendErr := errors.New("broker down")
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndFail(func(msg *sarama.ProducerMessage) error {
+		a.Nil(msg.Key, "a message without Raw has no key")
+		a.NotContains(headersOf(msg), HeaderTopic)
+		return nil
+	}, sendErr)
+	d := NewDeadLetterWithProducer(mock, "dlq")
+	a.ErrorIs(d.SendDeadLetter(ctx, &core.DeadLetterMessage{Stage: "extract", Attempts: 1}), sendErr)
+	a.NoError(d.Close(ctx))
+}
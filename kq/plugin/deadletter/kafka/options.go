@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+
+	"github.com/IBM/sarama"
+)
+
+type options struct {
+	kafkaOptions []pkgxkafka.Option
+}
+
+type Option func(*options)
+
+// WithKafkaOptions applies options of the kafka package to the producer config, e.g. kafka.WithTLS
+func WithKafkaOptions(kafkaOptions ...pkgxkafka.Option) Option {
+	return func(o *options) {
+		o.kafkaOptions = append(o.kafkaOptions, kafkaOptions...)
+	}
+}
+
+// WithSASLPlainText use SASLTypePlaintext instead of SCRAM-SHA-512
+func WithSASLPlainText() Option {
+	return WithKafkaOptions(pkgxkafka.WithSASLPlainText())
+}
+
+// WithVersion sets the kafka protocol version
+func WithVersion(version sarama.KafkaVersion) Option {
+	return WithKafkaOptions(pkgxkafka.WithVersion(version))
+}
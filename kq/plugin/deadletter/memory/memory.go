@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+var _ core.DeadLetter = (*DeadLetter)(nil)
+
+// DeadLetter keeps dead letters in memory, it is meant for tests.
+type DeadLetter struct {
+	mu       sync.Mutex
+	messages []*core.DeadLetterMessage
+}
+
+func NewDeadLetter() *DeadLetter {
+	return &DeadLetter{}
+}
+
+func (d *DeadLetter) SendDeadLetter(ctx context.Context, message *core.DeadLetterMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages = append(d.messages, message)
+	return nil
+}
+
+// Messages returns a copy of the dead letters received so far.
+func (d *DeadLetter) Messages() []*core.DeadLetterMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	messages := make([]*core.DeadLetterMessage, len(d.messages))
+	copy(messages, d.messages)
+	return messages
+}
+
+// Reset drops every dead letter received so far.
+func (d *DeadLetter) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages = nil
+}
+
+func (d *DeadLetter) Close(ctx context.Context) error {
+	return nil
+}
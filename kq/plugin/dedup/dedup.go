@@ -0,0 +1,88 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Store remembers the keys of the messages being processed and already processed.
+type Store interface {
+	// Claim reserves key for ttl, it returns false when key is already claimed or completed.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Complete marks key as processed for ttl.
+	Complete(ctx context.Context, key string, ttl time.Duration) error
+	// Release forgets key so a redelivered message is processed again.
+	Release(ctx context.Context, key string) error
+}
+
+// Middleware skips the messages whose key has already been processed, they are acked without
+// reaching the transformer. A key is claimed before the transformer stage, completed once the outputs
+// were sent, see core.StageMessage.OnSent, or the transformer dropped the message, and released when
+// either stage failed. The key of a message held by an aggregator is completed once the aggregates
+// listing it were sent. A failed Claim fails the transformer stage, a failed Complete only shortens
+// how long the key is remembered to the claim TTL.
+func Middleware(store Store, opts ...Option) core.Middleware {
+	o := &options{
+		ttl:      defaultTTL,
+		claimTTL: defaultClaimTTL,
+		keyFunc: func(message core.Message) string {
+			return message.ID()
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			if message.Message == nil {
+				return next(ctx, message)
+			}
+			key := o.keyFunc(message.Message)
+			if key == "" {
+				return next(ctx, message)
+			}
+			switch message.Stage {
+			case core.StageTransformer:
+				claimed, err := store.Claim(ctx, key, o.claimTTL)
+				if err != nil {
+					return err
+				}
+				if !claimed {
+					if o.onDuplicate != nil {
+						o.onDuplicate(ctx, message)
+					}
+					return nil
+				}
+				if err := next(ctx, message); err != nil {
+					_ = store.Release(ctx, key)
+					return err
+				}
+				if message.Output == nil || len(message.Output.Outputs()) == 0 {
+					_ = store.Complete(ctx, key, o.ttl)
+				} else if message.Output.Held() > 0 {
+					// a held message does not go through the output stage, its aggregates do
+					message.OnSent(complete(store, key, o.ttl))
+				}
+				return nil
+			case core.StageOutput:
+				message.OnSent(complete(store, key, o.ttl))
+				return next(ctx, message)
+			default:
+				return next(ctx, message)
+			}
+		}
+	}
+}
+
+// complete completes key once the message was sent, or releases it when the message failed.
+func complete(store Store, key string, ttl time.Duration) func(ctx context.Context, err error) {
+	return func(ctx context.Context, err error) {
+		if err != nil {
+			_ = store.Release(ctx, key)
+			return
+		}
+		_ = store.Complete(ctx, key, ttl)
+	}
+}
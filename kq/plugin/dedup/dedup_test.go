@@ -0,0 +1,259 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq"
+	"github.com/colinrs/pkgx/kq/core"
+	kqjson "github.com/colinrs/pkgx/kq/plugin/extractor/json"
+	inmemory "github.com/colinrs/pkgx/kq/plugin/input/memory"
+	outmemory "github.com/colinrs/pkgx/kq/plugin/output/memory"
+	"github.com/colinrs/pkgx/kq/plugin/transformer"
+	"github.com/colinrs/pkgx/kq/plugin/window"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMessage struct {
+	id string
+}
+
+func (m *testMessage) ID() string           { return m.id }
+func (m *testMessage) Timestamp() time.Time { return time.Time{} }
+func (m *testMessage) Ctx() context.Context { return context.Background() }
+
+func TestMemoryStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	s := NewMemoryStore(2)
+	s.now = func() time.Time { return now }
+
+	claimed, _ := s.Claim(ctx, "a", time.Second)
+	a.True(claimed)
+	claimed, _ = s.Claim(ctx, "a", time.Second)
+	a.False(claimed)
+	a.NoError(s.Complete(ctx, "a", time.Minute))
+	now = now.Add(30 * time.Second)
+	claimed, _ = s.Claim(ctx, "a", time.Second)
+	a.False(claimed)
+	now = now.Add(time.Minute)
+	claimed, _ = s.Claim(ctx, "a", time.Second)
+	a.True(claimed)
+
+	a.NoError(s.Release(ctx, "a"))
+	claimed, _ = s.Claim(ctx, "a", time.Second)
+	a.True(claimed)
+
+	_, _ = s.Claim(ctx, "b", time.Second)
+	_, _ = s.Claim(ctx, "c", time.Second)
+	a.Equal(2, s.Len())
+	claimed, _ = s.Claim(ctx, "a", time.Second)
+	a.True(claimed, "the oldest key is evicted")
+}
+
+type testCache struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func (c *testCache) TrySet(ctx context.Context, key string, value interface{},
+	expiration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+	c.values[key] = value
+	return true, nil
+}
+
+func (c *testCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func (c *testCache) Del(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+	return nil
+}
+
+func TestRedisStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := &testCache{values: make(map[string]interface{})}
+	s := NewRedisStore(c, "group:")
+	claimed, err := s.Claim(ctx, "a", time.Second)
+	a.NoError(err)
+	a.True(claimed)
+	claimed, err = s.Claim(ctx, "a", time.Second)
+	a.NoError(err)
+	a.False(claimed)
+	a.NoError(s.Complete(ctx, "a", time.Minute))
+	a.Equal(completedValue, c.values["group:a"])
+	a.NoError(s.Release(ctx, "a"))
+	a.Empty(c.values)
+}
+
+func TestMiddlewareRelease(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	processErr := errors.New("process")
+	handler := Middleware(store)(func(ctx context.Context, message *core.StageMessage) error {
+		return processErr
+	})
+	message := &core.StageMessage{Stage: core.StageTransformer, Message: &testMessage{id: "a"}}
+	a.ErrorIs(handler(ctx, message), processErr)
+	a.Equal(0, store.Len())
+
+	message.Stage = core.StageOutput
+	a.ErrorIs(handler(ctx, message), processErr)
+	a.Equal(0, store.Len())
+}
+
+type order struct {
+	ID int `json:"id"`
+}
+
+func TestMiddlewareSkipsDuplicates(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	input := inmemory.NewInputFromSlice(inmemory.Messages("orders",
+		[]byte(`{"id":1}`), []byte(`{"id":2}`), []byte(`{"id":1}`), []byte(`{"id":3}`), []byte(`{"id":2}`)))
+	output := outmemory.NewOutput()
+	var mu sync.Mutex
+	var duplicates []string
+	k := kq.NewKQ(ctx, kq.WithMaxGoroutines(1)).
+		SetInput(ctx, input).
+		SetExtractor(ctx, kqjson.NewExtractor[order](ctx, kqjson.WithIDField("id"))).
+		SetMiddleware(ctx, Middleware(NewMemoryStore(0), WithOnDuplicate(
+			func(ctx context.Context, message *core.StageMessage) {
+				mu.Lock()
+				defer mu.Unlock()
+				duplicates = append(duplicates, message.Message.ID())
+			}))).
+		SetTransformer(ctx, transformer.Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+			return message.ID(), nil
+		})).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	a.ElementsMatch([]interface{}{"1", "2", "3"}, output.Values())
+	mu.Lock()
+	a.ElementsMatch([]string{"1", "2"}, duplicates)
+	mu.Unlock()
+	a.Equal(map[string]map[int32]int64{"orders": {0: 4}}, input.Committed())
+}
+
+func TestMiddlewareCompletesOnSent(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	c := &testCache{values: make(map[string]interface{})}
+	handler := Middleware(NewRedisStore(c, ""))(func(ctx context.Context, message *core.StageMessage) error {
+		return nil
+	})
+	for _, sendErr := range []error{nil, errors.New("send")} {
+		message := &core.StageMessage{
+			Stage:   core.StageTransformer,
+			Message: &testMessage{id: "a"},
+			Output:  &core.OutputMessage{Data: "a"},
+		}
+		a.NoError(handler(ctx, message))
+		message.Stage = core.StageOutput
+		a.NoError(handler(ctx, message))
+		a.Equal(claimedValue, c.values["a"], "the key is claimed until the output is sent")
+		message.Sent(ctx, sendErr)
+		if sendErr == nil {
+			a.Equal(completedValue, c.values["a"])
+			delete(c.values, "a")
+		} else {
+			a.Empty(c.values)
+		}
+	}
+}
+
+// claimCheckOutput records the value of the keys when their batch is sent.
+type claimCheckOutput struct {
+	*outmemory.Output
+	cache  *testCache
+	values []interface{}
+}
+
+func (o *claimCheckOutput) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	o.cache.mu.Lock()
+	for _, message := range messages {
+		o.values = append(o.values, o.cache.values[message.Data.(string)])
+	}
+	o.cache.mu.Unlock()
+	return o.Output.SendOutputs(ctx, messages)
+}
+
+func TestMiddlewareBatch(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := &testCache{values: make(map[string]interface{})}
+	output := &claimCheckOutput{Output: outmemory.NewOutput(), cache: c}
+	input := inmemory.NewInputFromSlice(inmemory.Messages("orders",
+		[]byte(`{"id":1}`), []byte(`{"id":2}`), []byte(`{"id":3}`)))
+	k := kq.NewKQ(ctx, kq.WithBatch(kq.BatchOptions{MaxSize: 3, Linger: time.Second})).
+		SetInput(ctx, input).
+		SetExtractor(ctx, kqjson.NewExtractor[order](ctx, kqjson.WithIDField("id"))).
+		SetMiddleware(ctx, Middleware(NewRedisStore(c, ""))).
+		SetTransformer(ctx, transformer.Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+			return message.ID(), nil
+		})).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	a.Equal([]interface{}{claimedValue, claimedValue, claimedValue}, output.values)
+	a.Equal(map[string]interface{}{"1": completedValue, "2": completedValue, "3": completedValue}, c.values)
+}
+
+func TestMiddlewareAggregator(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := &testCache{values: make(map[string]interface{})}
+	input := inmemory.NewInputFromSlice(inmemory.Messages("orders",
+		[]byte(`{"id":1}`), []byte(`{"id":2}`), []byte(`{"id":3}`)))
+	output := outmemory.NewOutput()
+	aggregator, err := window.New(window.Tumbling(time.Hour), window.Count())
+	a.NoError(err)
+	k := kq.NewKQ(ctx).
+		SetInput(ctx, input).
+		SetExtractor(ctx, kqjson.NewExtractor[order](ctx, kqjson.WithIDField("id"))).
+		SetMiddleware(ctx, Middleware(NewRedisStore(c, ""))).
+		SetTransformer(ctx, aggregator).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	a.Eventually(func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.values) == 3
+	}, time.Second, time.Millisecond)
+	a.NoError(k.Close(ctx))
+
+	a.Len(output.Values(), 1)
+	for _, key := range []string{"1", "2", "3"} {
+		a.Equal(completedValue, c.values[key], "the keys of the held messages are completed with their aggregate")
+	}
+}
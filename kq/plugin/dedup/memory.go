@@ -0,0 +1,91 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMemoryCapacity = 100000
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+type memoryEntry struct {
+	key      string
+	expireAt time.Time
+}
+
+// MemoryStore keeps the keys of a single process in memory, the least recently claimed keys
+// are evicted first once the capacity is reached.
+type MemoryStore struct {
+	capacity int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// NewMemoryStore returns a MemoryStore holding at most capacity keys, 100000 when capacity <= 0.
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = defaultMemoryCapacity
+	}
+	return &MemoryStore{
+		capacity: capacity,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		if now.Before(entry.expireAt) {
+			return false, nil
+		}
+		entry.expireAt = now.Add(ttl)
+		s.lru.MoveToFront(element)
+		return true, nil
+	}
+	s.entries[key] = s.lru.PushFront(&memoryEntry{key: key, expireAt: now.Add(ttl)})
+	for s.lru.Len() > s.capacity {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*memoryEntry).expireAt = s.now().Add(ttl)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Len returns how many keys are held, expired ones included until they are evicted.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
@@ -0,0 +1,52 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	defaultTTL      = 24 * time.Hour
+	defaultClaimTTL = 5 * time.Minute
+)
+
+type options struct {
+	ttl         time.Duration
+	claimTTL    time.Duration
+	keyFunc     func(message core.Message) string
+	onDuplicate func(ctx context.Context, message *core.StageMessage)
+}
+
+type Option func(*options)
+
+// WithTTL sets how long a processed ID is remembered, 24h by default
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithClaimTTL sets how long an ID stays reserved while its message is processed, 5m by default,
+// it bounds how long a redelivery is skipped when the process dies in the middle
+func WithClaimTTL(claimTTL time.Duration) Option {
+	return func(o *options) {
+		o.claimTTL = claimTTL
+	}
+}
+
+// WithKeyFunc sets the deduplication key of a message, core.Message.ID by default,
+// messages with an empty key are never skipped
+func WithKeyFunc(keyFunc func(message core.Message) string) Option {
+	return func(o *options) {
+		o.keyFunc = keyFunc
+	}
+}
+
+// WithOnDuplicate is called for every skipped message, e.g. to count them
+func WithOnDuplicate(onDuplicate func(ctx context.Context, message *core.StageMessage)) Option {
+	return func(o *options) {
+		o.onDuplicate = onDuplicate
+	}
+}
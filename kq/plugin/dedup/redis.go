@@ -0,0 +1,49 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/colinrs/pkgx/cache"
+)
+
+const (
+	claimedValue   = "claimed"
+	completedValue = "completed"
+)
+
+var (
+	_ Store = (*RedisStore)(nil)
+	_ Cache = (*cache.RedisCacheClient)(nil)
+)
+
+// Cache is the part of a cache the RedisStore needs, *cache.RedisCacheClient implements it.
+type Cache interface {
+	// TrySet sets key unless it exists and reports whether it was set.
+	TrySet(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	Del(ctx context.Context, key string) error
+}
+
+// RedisStore shares the keys between every consumer of a group through a Cache.
+type RedisStore struct {
+	cache  Cache
+	prefix string
+}
+
+// NewRedisStore returns a RedisStore whose keys are prefixed with prefix, e.g. the group ID.
+func NewRedisStore(c Cache, prefix string) *RedisStore {
+	return &RedisStore{cache: c, prefix: prefix}
+}
+
+func (s *RedisStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.cache.TrySet(ctx, s.prefix+key, claimedValue, ttl)
+}
+
+func (s *RedisStore) Complete(ctx context.Context, key string, ttl time.Duration) error {
+	return s.cache.Set(ctx, s.prefix+key, completedValue, ttl)
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return s.cache.Del(ctx, s.prefix+key)
+}
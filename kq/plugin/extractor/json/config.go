@@ -0,0 +1,44 @@
+package json
+
+import (
+	"context"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Config is the configuration of the extractors registered with Register.
+type Config struct {
+	IDField         string `yaml:"id_field" json:"id_field"`
+	IDHeader        string `yaml:"id_header" json:"id_header"`
+	TimestampField  string `yaml:"timestamp_field" json:"timestamp_field"`
+	TimestampHeader string `yaml:"timestamp_header" json:"timestamp_header"`
+}
+
+func init() {
+	Register[map[string]interface{}]("json")
+}
+
+// Register makes an extractor decoding records into a T available to configured pipelines,
+// "json" decodes them into a map[string]interface{}.
+func Register[T any](name string) {
+	core.RegisterExtractor(name, func(ctx context.Context, config core.PluginConfig) (core.Extractor, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		var opts []Option
+		if c.IDField != "" {
+			opts = append(opts, WithIDField(c.IDField))
+		}
+		if c.IDHeader != "" {
+			opts = append(opts, WithIDHeader(c.IDHeader))
+		}
+		if c.TimestampField != "" {
+			opts = append(opts, WithTimestampField(c.TimestampField))
+		}
+		if c.TimestampHeader != "" {
+			opts = append(opts, WithTimestampHeader(c.TimestampHeader))
+		}
+		return NewExtractor[T](ctx, opts...), nil
+	})
+}
@@ -2,25 +2,183 @@ package json
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	jsoniter "github.com/json-iterator/go"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+var (
+	ErrEmptyRecord = errors.New("json extractor: empty record")
+	ErrNoField     = errors.New("json extractor: field not found")
 )
 
-type extractor struct {
+// Message is the core.Message produced by the extractor, Value holds the decoded record.
+type Message[T any] struct {
+	Value T
+	Raw   *sarama.ConsumerMessage
+
+	id        string
+	timestamp time.Time
+	ctx       context.Context
+}
+
+func (m *Message[T]) ID() string {
+	return m.id
+}
+
+func (m *Message[T]) Timestamp() time.Time {
+	return m.timestamp
+}
+
+func (m *Message[T]) Ctx() context.Context {
+	return m.ctx
+}
+
+// Value returns the decoded value of a message produced by an extractor of type T.
+func Value[T any](message core.Message) (T, bool) {
+	m, ok := message.(*Message[T])
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return m.Value, true
+}
+
+type extractor[T any] struct {
+	options
+}
+
+// NewExtractor returns a core.Extractor decoding InputMessage.Raw.Value into a T.
+// Without options the ID is the record key, or topic-partition-offset when the key is empty,
+// and the timestamp is the record timestamp.
+func NewExtractor[T any](ctx context.Context, opts ...Option) core.Extractor {
+	e := &extractor[T]{}
+	for _, opt := range opts {
+		opt(&e.options)
+	}
+	return e
+}
+
+func (e *extractor[T]) Unmarshal(ctx context.Context, inputMessage *core.InputMessage) (core.Message, error) {
+	raw := inputMessage.Raw
+	if raw == nil || len(raw.Value) == 0 {
+		return nil, ErrEmptyRecord
+	}
+	m := &Message[T]{Raw: raw, ctx: ctx}
+	if err := json.Unmarshal(raw.Value, &m.Value); err != nil {
+		return nil, fmt.Errorf("json extractor: decode %s/%d/%d: %w", raw.Topic, raw.Partition, raw.Offset, err)
+	}
+	id, err := e.id(raw)
+	if err != nil {
+		return nil, err
+	}
+	m.id = id
+	timestamp, err := e.timestamp(raw)
+	if err != nil {
+		return nil, err
+	}
+	m.timestamp = timestamp
+	if e.contextFunc != nil {
+		m.ctx = e.contextFunc(ctx, raw)
+	}
+	return m, nil
+}
+
+func (e *extractor[T]) id(raw *sarama.ConsumerMessage) (string, error) {
+	switch {
+	case e.idField != "":
+		value, ok := field(raw.Value, e.idField)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrNoField, e.idField)
+		}
+		return value, nil
+	case e.idHeader != "":
+		value, ok := header(raw, e.idHeader)
+		if !ok {
+			return "", fmt.Errorf("%w: header %s", ErrNoField, e.idHeader)
+		}
+		return value, nil
+	case len(raw.Key) > 0:
+		return string(raw.Key), nil
+	default:
+		return fmt.Sprintf("%s-%d-%d", raw.Topic, raw.Partition, raw.Offset), nil
+	}
+}
+
+func (e *extractor[T]) timestamp(raw *sarama.ConsumerMessage) (time.Time, error) {
+	switch {
+	case e.timestampField != "":
+		value, ok := field(raw.Value, e.timestampField)
+		if !ok {
+			return time.Time{}, fmt.Errorf("%w: %s", ErrNoField, e.timestampField)
+		}
+		return parseTimestamp(value)
+	case e.timestampHeader != "":
+		value, ok := header(raw, e.timestampHeader)
+		if !ok {
+			return time.Time{}, fmt.Errorf("%w: header %s", ErrNoField, e.timestampHeader)
+		}
+		return parseTimestamp(value)
+	default:
+		return raw.Timestamp, nil
+	}
+}
+
+func (e *extractor[T]) OnDone(ctx context.Context, inputMessage *core.InputMessage) {
+	if e.onDone != nil {
+		e.onDone(ctx, inputMessage)
+	}
 }
 
-func NewExtractor(ctx context.Context) core.Extractor {
-	return nil
+func (e *extractor[T]) OnError(ctx context.Context, inputMessage *core.InputMessage, err error) {
+	if e.onError != nil {
+		e.onError(ctx, inputMessage, err)
+		return
+	}
+	fmt.Printf("kq json extractor got errors. err=[%v]\n", err)
 }
 
-func (e *extractor) Unmarshal(ctx context.Context, inputMessage *core.InputMessage) (interface{}, error) {
-	return nil, nil
+// field reads the value at a dotted path of a record without decoding the rest of it,
+// a number keeps its text so large IDs are not rounded.
+func field(data []byte, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	p := make([]interface{}, len(keys))
+	for i, key := range keys {
+		p[i] = key
+	}
+	value := json.Get(data, p...)
+	switch value.ValueType() {
+	case jsoniter.InvalidValue, jsoniter.NilValue:
+		return "", false
+	}
+	return value.ToString(), true
 }
 
-func (e *extractor) OnDone(cxt context.Context, inputMessage *core.InputMessage) {
-	return
+func header(raw *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range raw.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
 }
 
-func (e *extractor) OnError(cxt context.Context, inputMessage *core.InputMessage) (interface{}, error) {
-	return nil, nil
+// parseTimestamp accepts RFC3339 strings and unix timestamps in seconds or milliseconds.
+func parseTimestamp(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1e11 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
 }
@@ -0,0 +1,105 @@
+package json
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	ID     int64 `json:"id"`
+	Amount int   `json:"amount"`
+	Meta   struct {
+		CreatedAt string `json:"created_at"`
+	} `json:"meta"`
+}
+
+func newInputMessage(raw *sarama.ConsumerMessage) *core.InputMessage {
+	m := core.NewInputMessage()
+	m.Raw = raw
+	return m
+}
+
+func TestExtractorFields(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	e := NewExtractor[order](ctx, WithIDField("id"), WithTimestampField("meta.created_at"))
+	m, err := e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{
+		Value: []byte(`{"id":12345678901,"amount":3,"meta":{"created_at":"2023-01-02T03:04:05Z"}}`),
+	}))
+	a.NoError(err)
+	a.Equal("12345678901", m.ID())
+	a.Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), m.Timestamp())
+	value, ok := Value[order](m)
+	a.True(ok)
+	a.Equal(3, value.Amount)
+}
+
+func TestExtractorRecordDefaults(t *testing.T) {
+	a := assert.New(t)
+	type ctxKey struct{}
+	ctx := context.Background()
+	now := time.Now()
+	e := NewExtractor[map[string]interface{}](ctx,
+		WithTimestampHeader("ts"),
+		WithContext(func(ctx context.Context, raw *sarama.ConsumerMessage) context.Context {
+			return context.WithValue(ctx, ctxKey{}, raw.Offset)
+		}))
+	m, err := e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 1,
+		Offset:    7,
+		Value:     []byte(`{"a":1}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("ts"), Value: []byte("1672628645000")},
+		},
+		Timestamp: now,
+	}))
+	a.NoError(err)
+	a.Equal("orders-1-7", m.ID())
+	a.Equal(int64(1672628645000), m.Timestamp().UnixMilli())
+	a.Equal(int64(7), m.Ctx().Value(ctxKey{}))
+}
+
+func TestExtractorErrors(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	var reported error
+	e := NewExtractor[order](ctx, WithIDField("missing"), WithOnError(
+		func(ctx context.Context, message *core.InputMessage, err error) {
+			reported = err
+		}))
+	in := newInputMessage(&sarama.ConsumerMessage{Value: []byte(`{"id":`)})
+	_, err := e.Unmarshal(ctx, in)
+	a.Error(err)
+	e.OnError(ctx, in, err)
+	a.Equal(err, reported)
+
+	_, err = e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{Value: []byte(`{"id":1}`)}))
+	a.ErrorIs(err, ErrNoField)
+
+	_, err = e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{}))
+	a.ErrorIs(err, ErrEmptyRecord)
+}
+
+func TestExtractorFieldPaths(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	e := NewExtractor[map[string]interface{}](ctx, WithIDField("meta.id"), WithTimestampField("ts"))
+	m, err := e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{
+		Value: []byte(`{"ts":1672628645123,"meta":{"id":"a-1"}}`),
+	}))
+	a.NoError(err)
+	a.Equal("a-1", m.ID())
+	a.Equal(int64(1672628645123), m.Timestamp().UnixMilli())
+
+	for _, value := range []string{`{"ts":1,"meta":{"id":null}}`, `{"ts":1,"meta":"id"}`, `{"ts":1}`} {
+		_, err = e.Unmarshal(ctx, newInputMessage(&sarama.ConsumerMessage{Value: []byte(value)}))
+		a.ErrorIs(err, ErrNoField, value)
+	}
+}
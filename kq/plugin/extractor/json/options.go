@@ -0,0 +1,71 @@
+package json
+
+import (
+	"context"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+type options struct {
+	idField         string
+	idHeader        string
+	timestampField  string
+	timestampHeader string
+	contextFunc     func(ctx context.Context, raw *sarama.ConsumerMessage) context.Context
+	onDone          func(ctx context.Context, message *core.InputMessage)
+	onError         func(ctx context.Context, message *core.InputMessage, err error)
+}
+
+type Option func(*options)
+
+// WithIDField takes the message ID from a JSON field, nested fields are separated by dots
+func WithIDField(field string) Option {
+	return func(o *options) {
+		o.idField = field
+	}
+}
+
+// WithIDHeader takes the message ID from a kafka header
+func WithIDHeader(header string) Option {
+	return func(o *options) {
+		o.idHeader = header
+	}
+}
+
+// WithTimestampField takes the message timestamp from a JSON field,
+// either an RFC3339 string or a unix timestamp in seconds or milliseconds
+func WithTimestampField(field string) Option {
+	return func(o *options) {
+		o.timestampField = field
+	}
+}
+
+// WithTimestampHeader takes the message timestamp from a kafka header, formatted like WithTimestampField
+func WithTimestampHeader(header string) Option {
+	return func(o *options) {
+		o.timestampHeader = header
+	}
+}
+
+// WithContext derives the message context from the record, e.g. to extract a trace from its headers
+func WithContext(contextFunc func(ctx context.Context, raw *sarama.ConsumerMessage) context.Context) Option {
+	return func(o *options) {
+		o.contextFunc = contextFunc
+	}
+}
+
+// WithOnDone is called after a record has been decoded
+func WithOnDone(onDone func(ctx context.Context, message *core.InputMessage)) Option {
+	return func(o *options) {
+		o.onDone = onDone
+	}
+}
+
+// WithOnError is called when a record could not be decoded
+func WithOnError(onError func(ctx context.Context, message *core.InputMessage, err error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
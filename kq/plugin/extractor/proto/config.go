@@ -0,0 +1,65 @@
+package proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Config is the configuration of the "proto" extractor of configured pipelines, the types are
+// looked up by full name among the generated types linked into the binary, e.g. google.protobuf.Timestamp.
+type Config struct {
+	MessageType string `yaml:"message_type" json:"message_type"`
+	// TypeURLHeader and MessageTypes decode records into the type named by a header, see WithTypeURLHeader.
+	TypeURLHeader string   `yaml:"type_url_header" json:"type_url_header"`
+	MessageTypes  []string `yaml:"message_types" json:"message_types"`
+	IDHeader      string   `yaml:"id_header" json:"id_header"`
+}
+
+func init() {
+	core.RegisterExtractor("proto", func(ctx context.Context, config core.PluginConfig) (core.Extractor, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if c.MessageType == "" && c.TypeURLHeader == "" {
+			return nil, errors.New("proto extractor: message_type or type_url_header is required")
+		}
+		var prototype protobuf.Message
+		if c.MessageType != "" {
+			var err error
+			if prototype, err = findMessageType(c.MessageType); err != nil {
+				return nil, err
+			}
+		}
+		var opts []Option
+		if c.TypeURLHeader != "" {
+			opts = append(opts, WithTypeURLHeader(c.TypeURLHeader))
+		}
+		for _, name := range c.MessageTypes {
+			messageType, err := findMessageType(name)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithMessageTypes(messageType))
+		}
+		if c.IDHeader != "" {
+			opts = append(opts, WithIDHeader(c.IDHeader))
+		}
+		return NewExtractor(ctx, prototype, opts...), nil
+	})
+}
+
+func findMessageType(name string) (protobuf.Message, error) {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	return messageType.New().Interface(), nil
+}
@@ -0,0 +1,81 @@
+package proto
+
+import (
+	"context"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+type options struct {
+	typeURLHeader string
+	messageTypes  []protobuf.Message
+	idHeader      string
+	idFunc        func(message protobuf.Message) string
+	timestampFunc func(message protobuf.Message) time.Time
+	contextFunc   func(ctx context.Context, raw *sarama.ConsumerMessage) context.Context
+	onDone        func(ctx context.Context, message *core.InputMessage)
+	onError       func(ctx context.Context, message *core.InputMessage, err error)
+}
+
+type Option func(*options)
+
+// WithTypeURLHeader reads the type URL of every record from a kafka header
+// and decodes it into the matching type registered with WithMessageTypes
+func WithTypeURLHeader(header string) Option {
+	return func(o *options) {
+		o.typeURLHeader = header
+	}
+}
+
+// WithMessageTypes registers the types a type URL header may refer to
+func WithMessageTypes(prototypes ...protobuf.Message) Option {
+	return func(o *options) {
+		o.messageTypes = append(o.messageTypes, prototypes...)
+	}
+}
+
+// WithIDHeader takes the message ID from a kafka header
+func WithIDHeader(header string) Option {
+	return func(o *options) {
+		o.idHeader = header
+	}
+}
+
+// WithIDFunc takes the message ID from the decoded message
+func WithIDFunc(idFunc func(message protobuf.Message) string) Option {
+	return func(o *options) {
+		o.idFunc = idFunc
+	}
+}
+
+// WithTimestampFunc takes the message timestamp from the decoded message
+func WithTimestampFunc(timestampFunc func(message protobuf.Message) time.Time) Option {
+	return func(o *options) {
+		o.timestampFunc = timestampFunc
+	}
+}
+
+// WithContext derives the message context from the record, e.g. to extract a trace from its headers
+func WithContext(contextFunc func(ctx context.Context, raw *sarama.ConsumerMessage) context.Context) Option {
+	return func(o *options) {
+		o.contextFunc = contextFunc
+	}
+}
+
+// WithOnDone is called after a record has been decoded
+func WithOnDone(onDone func(ctx context.Context, message *core.InputMessage)) Option {
+	return func(o *options) {
+		o.onDone = onDone
+	}
+}
+
+// WithOnError is called when a record could not be decoded
+func WithOnError(onError func(ctx context.Context, message *core.InputMessage, err error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
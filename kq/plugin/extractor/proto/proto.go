@@ -1,14 +1,168 @@
 package proto
 
-import "github.com/colinrs/pkgx/kq/core"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	typeURLPrefix = "type.googleapis.com/"
+)
+
+var (
+	ErrNoRecord    = errors.New("proto extractor: no record")
+	ErrUnknownType = errors.New("proto extractor: unknown message type")
+	ErrNoHeader    = errors.New("proto extractor: header not found")
+)
+
+// Message is the core.Message produced by the extractor, Value holds the decoded record.
+type Message struct {
+	Value protobuf.Message
+	Raw   *sarama.ConsumerMessage
+
+	id        string
+	timestamp time.Time
+	ctx       context.Context
+}
+
+func (m *Message) ID() string {
+	return m.id
+}
+
+func (m *Message) Timestamp() time.Time {
+	return m.timestamp
+}
+
+func (m *Message) Ctx() context.Context {
+	return m.ctx
+}
 
 type extractor struct {
+	options
+	prototype protoreflect.Message
+	types     map[string]protoreflect.Message
+}
+
+// NewExtractor returns a core.Extractor decoding InputMessage.Raw.Value into a fresh clone of prototype.
+// prototype may be nil when every record carries a type URL header.
+// Without options the ID is the record key, or topic-partition-offset when the key is empty,
+// and the timestamp is the record timestamp.
+func NewExtractor(ctx context.Context, prototype protobuf.Message, opts ...Option) core.Extractor {
+	e := &extractor{
+		types: make(map[string]protoreflect.Message),
+	}
+	for _, opt := range opts {
+		opt(&e.options)
+	}
+	if prototype != nil {
+		e.prototype = prototype.ProtoReflect()
+		e.register(e.prototype)
+	}
+	for _, t := range e.messageTypes {
+		e.register(t.ProtoReflect())
+	}
+	return e
+}
+
+// register makes a type reachable both by its type URL and by its full name.
+func (e *extractor) register(m protoreflect.Message) {
+	fullName := string(m.Descriptor().FullName())
+	e.types[fullName] = m
+	e.types[typeURLPrefix+fullName] = m
+}
+
+func (e *extractor) Unmarshal(ctx context.Context, inputMessage *core.InputMessage) (core.Message, error) {
+	raw := inputMessage.Raw
+	// an empty value is valid, it is a message whose fields all have their default value
+	if raw == nil {
+		return nil, ErrNoRecord
+	}
+	prototype, err := e.resolve(raw)
+	if err != nil {
+		return nil, err
+	}
+	value := prototype.New().Interface()
+	if err = protobuf.Unmarshal(raw.Value, value); err != nil {
+		return nil, fmt.Errorf("proto extractor: decode %s/%d/%d: %w", raw.Topic, raw.Partition, raw.Offset, err)
+	}
+	m := &Message{
+		Value:     value,
+		Raw:       raw,
+		timestamp: raw.Timestamp,
+		ctx:       ctx,
+	}
+	if m.id, err = e.id(raw, value); err != nil {
+		return nil, err
+	}
+	if e.timestampFunc != nil {
+		m.timestamp = e.timestampFunc(value)
+	}
+	if e.contextFunc != nil {
+		m.ctx = e.contextFunc(ctx, raw)
+	}
+	return m, nil
+}
+
+func (e *extractor) resolve(raw *sarama.ConsumerMessage) (protoreflect.Message, error) {
+	if e.typeURLHeader != "" {
+		if typeURL, ok := header(raw, e.typeURLHeader); ok {
+			if prototype, ok := e.types[strings.TrimSpace(typeURL)]; ok {
+				return prototype, nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrUnknownType, typeURL)
+		}
+	}
+	if e.prototype == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoHeader, e.typeURLHeader)
+	}
+	return e.prototype, nil
+}
+
+func (e *extractor) id(raw *sarama.ConsumerMessage, value protobuf.Message) (string, error) {
+	switch {
+	case e.idFunc != nil:
+		return e.idFunc(value), nil
+	case e.idHeader != "":
+		id, ok := header(raw, e.idHeader)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrNoHeader, e.idHeader)
+		}
+		return id, nil
+	case len(raw.Key) > 0:
+		return string(raw.Key), nil
+	default:
+		return fmt.Sprintf("%s-%d-%d", raw.Topic, raw.Partition, raw.Offset), nil
+	}
+}
+
+func (e *extractor) OnDone(ctx context.Context, inputMessage *core.InputMessage) {
+	if e.onDone != nil {
+		e.onDone(ctx, inputMessage)
+	}
 }
 
-func NewExtractor() core.Extractor {
-	return nil
+func (e *extractor) OnError(ctx context.Context, inputMessage *core.InputMessage, err error) {
+	if e.onError != nil {
+		e.onError(ctx, inputMessage, err)
+		return
+	}
+	fmt.Printf("kq proto extractor got errors. err=[%v]\n", err)
 }
 
-func (e *extractor) Unmarshal(*core.InputMessage) (interface{}, error) {
-	return nil, nil
+func header(raw *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range raw.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
 }
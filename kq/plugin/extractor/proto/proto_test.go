@@ -0,0 +1,119 @@
+package proto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newInputMessage(t *testing.T, value protobuf.Message, headers ...*sarama.RecordHeader) *core.InputMessage {
+	b, err := protobuf.Marshal(value)
+	assert.NoError(t, err)
+	m := core.NewInputMessage()
+	m.Raw = &sarama.ConsumerMessage{Topic: "events", Offset: 3, Value: b, Headers: headers}
+	return m
+}
+
+func TestExtractorPrototype(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	e := NewExtractor(ctx, &wrapperspb.StringValue{}, WithIDFunc(func(message protobuf.Message) string {
+		return message.(*wrapperspb.StringValue).GetValue()
+	}))
+	first, err := e.Unmarshal(ctx, newInputMessage(t, wrapperspb.String("a")))
+	a.NoError(err)
+	second, err := e.Unmarshal(ctx, newInputMessage(t, wrapperspb.String("b")))
+	a.NoError(err)
+	a.Equal("a", first.ID())
+	a.Equal("b", second.ID())
+	a.Equal("a", first.(*Message).Value.(*wrapperspb.StringValue).GetValue())
+}
+
+func TestExtractorTypeURL(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	at := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := NewExtractor(ctx, nil,
+		WithTypeURLHeader("type"),
+		WithMessageTypes(&wrapperspb.Int64Value{}, &timestamppb.Timestamp{}),
+		WithTimestampFunc(func(message protobuf.Message) time.Time {
+			if ts, ok := message.(*timestamppb.Timestamp); ok {
+				return ts.AsTime()
+			}
+			return time.Time{}
+		}))
+	m, err := e.Unmarshal(ctx, newInputMessage(t, timestamppb.New(at),
+		&sarama.RecordHeader{Key: []byte("type"), Value: []byte("type.googleapis.com/google.protobuf.Timestamp")}))
+	a.NoError(err)
+	a.Equal(at, m.Timestamp())
+	a.Equal("events-0-3", m.ID())
+
+	m, err = e.Unmarshal(ctx, newInputMessage(t, wrapperspb.Int64(9),
+		&sarama.RecordHeader{Key: []byte("type"), Value: []byte("google.protobuf.Int64Value")}))
+	a.NoError(err)
+	a.Equal(int64(9), m.(*Message).Value.(*wrapperspb.Int64Value).GetValue())
+
+	_, err = e.Unmarshal(ctx, newInputMessage(t, wrapperspb.Int64(9),
+		&sarama.RecordHeader{Key: []byte("type"), Value: []byte("google.protobuf.BoolValue")}))
+	a.ErrorIs(err, ErrUnknownType)
+
+	_, err = e.Unmarshal(ctx, newInputMessage(t, wrapperspb.Int64(9)))
+	a.ErrorIs(err, ErrNoHeader)
+}
+
+func TestExtractorDefaultMessage(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	e := NewExtractor(ctx, &wrapperspb.Int64Value{})
+	inputMessage := newInputMessage(t, wrapperspb.Int64(0))
+	a.Empty(inputMessage.Raw.Value)
+	m, err := e.Unmarshal(ctx, inputMessage)
+	a.NoError(err)
+	a.Equal(int64(0), m.(*Message).Value.(*wrapperspb.Int64Value).GetValue())
+
+	_, err = e.Unmarshal(ctx, core.NewInputMessage())
+	a.ErrorIs(err, ErrNoRecord)
+}
+
+// pluginConfig decodes into the Config it holds.
+type pluginConfig Config
+
+func (c pluginConfig) Decode(v interface{}) error {
+	*v.(*Config) = Config(c)
+	return nil
+}
+
+func TestRegisteredExtractor(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	factory, ok := core.LookupExtractor("proto")
+	a.True(ok)
+
+	e, err := factory(ctx, pluginConfig{MessageType: "google.protobuf.StringValue", IDHeader: "id"})
+	a.NoError(err)
+	m, err := e.Unmarshal(ctx, newInputMessage(t, wrapperspb.String("a"),
+		&sarama.RecordHeader{Key: []byte("id"), Value: []byte("1")}))
+	a.NoError(err)
+	a.Equal("1", m.ID())
+	a.Equal("a", m.(*Message).Value.(*wrapperspb.StringValue).GetValue())
+
+	e, err = factory(ctx, pluginConfig{TypeURLHeader: "type", MessageTypes: []string{"google.protobuf.Int64Value"}})
+	a.NoError(err)
+	m, err = e.Unmarshal(ctx, newInputMessage(t, wrapperspb.Int64(9),
+		&sarama.RecordHeader{Key: []byte("type"), Value: []byte("google.protobuf.Int64Value")}))
+	a.NoError(err)
+	a.Equal(int64(9), m.(*Message).Value.(*wrapperspb.Int64Value).GetValue())
+
+	_, err = factory(ctx, pluginConfig{MessageType: "missing.Type"})
+	a.ErrorIs(err, ErrUnknownType)
+	_, err = factory(ctx, pluginConfig{})
+	a.Error(err)
+}
@@ -0,0 +1,35 @@
+package file
+
+import (
+	"context"
+	"errors"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Config is the configuration of the "file" input of configured pipelines.
+type Config struct {
+	Path        string `yaml:"path" json:"path"`
+	Topic       string `yaml:"topic" json:"topic"`
+	MaxLineSize int    `yaml:"max_line_size" json:"max_line_size"`
+}
+
+func init() {
+	core.RegisterInput("file", func(ctx context.Context, config core.PluginConfig) (core.Input, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if c.Path == "" {
+			return nil, errors.New("file input: path is required")
+		}
+		var opts []Option
+		if c.Topic != "" {
+			opts = append(opts, WithTopic(c.Topic))
+		}
+		if c.MaxLineSize > 0 {
+			opts = append(opts, WithMaxLineSize(c.MaxLineSize))
+		}
+		return NewInput(c.Path, opts...)
+	})
+}
@@ -0,0 +1,135 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+var _ core.Input = (*Input)(nil)
+
+// Input replays a newline-delimited file, every non empty line becomes the value of a message
+// on partition 0 whose offset is the line number starting at 0.
+// Consumer returns core.ErrInputClosed at the end of the file,
+// or a *ScanError matching core.ErrInputClosed at a line it cannot read.
+type Input struct {
+	topic string
+
+	mu      sync.Mutex
+	file    *os.File
+	scanner *bufio.Scanner
+	line    int64
+	err     error
+	closed  bool
+
+	committed int64
+}
+
+// NewInput opens path, the topic defaults to the file name.
+func NewInput(path string, opts ...Option) (*Input, error) {
+	o := &options{
+		topic:       filepath.Base(path),
+		maxLineSize: defaultMaxLineSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	initialSize := o.maxLineSize
+	if initialSize > bufio.MaxScanTokenSize {
+		initialSize = bufio.MaxScanTokenSize
+	}
+	scanner.Buffer(make([]byte, 0, initialSize), o.maxLineSize)
+	return &Input{
+		topic:     o.topic,
+		file:      f,
+		scanner:   scanner,
+		committed: -1,
+	}, nil
+}
+
+// ScanError ends the input at a line which cannot be read, e.g. bufio.ErrTooLong for a line
+// longer than WithMaxLineSize. It matches core.ErrInputClosed so kq stops consuming the file.
+type ScanError struct {
+	Line int64
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("file input: line %d: %v", e.Line, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ScanError) Is(target error) bool {
+	return target == core.ErrInputClosed
+}
+
+func (in *Input) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for in.err == nil {
+		if !in.scanner.Scan() {
+			in.err = core.ErrInputClosed
+			if err := in.scanner.Err(); err != nil {
+				in.err = &ScanError{Line: in.line, Err: err}
+			}
+			break
+		}
+		offset := in.line
+		in.line++
+		if len(in.scanner.Bytes()) == 0 {
+			continue
+		}
+		value := make([]byte, len(in.scanner.Bytes()))
+		copy(value, in.scanner.Bytes())
+		m := core.NewInputMessage()
+		m.Raw = &sarama.ConsumerMessage{Topic: in.topic, Offset: offset, Value: value}
+		return m, nil
+	}
+	return nil, in.err
+}
+
+func (in *Input) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+	if inputMessage == nil || inputMessage.Raw == nil {
+		return nil
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.committed = inputMessage.Raw.Offset
+	return nil
+}
+
+// Committed returns the line number of the last committed message, -1 before the first commit.
+func (in *Input) Committed() int64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.committed
+}
+
+func (in *Input) Close(ctx context.Context) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.closed {
+		return nil
+	}
+	in.closed = true
+	in.err = core.ErrInputClosed
+	return in.file.Close()
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq"
+	"github.com/colinrs/pkgx/kq/core"
+	kqjson "github.com/colinrs/pkgx/kq/plugin/extractor/json"
+	"github.com/colinrs/pkgx/kq/plugin/output/memory"
+	"github.com/colinrs/pkgx/kq/plugin/transformer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "orders.jsonl")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInputOffsets(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	in, err := NewInput(writeFile(t, "a\n\nb\nc"))
+	a.NoError(err)
+	a.Equal(int64(-1), in.Committed())
+
+	var values []string
+	var offsets []int64
+	for {
+		m, err := in.Consumer(ctx)
+		if err != nil {
+			a.ErrorIs(err, core.ErrInputClosed)
+			break
+		}
+		a.Equal("orders.jsonl", m.Raw.Topic)
+		values = append(values, string(m.Raw.Value))
+		offsets = append(offsets, m.Raw.Offset)
+		a.NoError(in.CommitMessage(ctx, m))
+		a.Equal(m.Raw.Offset, in.Committed())
+	}
+	a.Equal([]string{"a", "b", "c"}, values)
+	a.Equal([]int64{0, 2, 3}, offsets, "empty lines keep their line number")
+
+	_, err = in.Consumer(ctx)
+	a.ErrorIs(err, core.ErrInputClosed, "the end of the file is sticky")
+	a.NoError(in.CommitMessage(ctx, nil))
+	a.Equal(int64(3), in.Committed())
+	a.NoError(in.Close(ctx))
+	a.NoError(in.Close(ctx))
+}
+
+func TestInputErrors(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	_, err := NewInput(filepath.Join(t.TempDir(), "missing.jsonl"))
+	a.True(os.IsNotExist(err))
+
+	in, err := NewInput(writeFile(t, "short\n"+strings.Repeat("x", 64)+"\n"), WithMaxLineSize(16))
+	a.NoError(err)
+	m, err := in.Consumer(ctx)
+	a.NoError(err)
+	a.Equal("short", string(m.Raw.Value))
+	_, err = in.Consumer(ctx)
+	var scanErr *ScanError
+	a.ErrorAs(err, &scanErr)
+	a.Equal(int64(1), scanErr.Line)
+	a.ErrorIs(err, bufio.ErrTooLong)
+	a.ErrorIs(err, core.ErrInputClosed, "a line too long ends the input")
+	_, err = in.Consumer(ctx)
+	a.ErrorIs(err, bufio.ErrTooLong, "the scan error is sticky")
+
+	in, err = NewInput(writeFile(t, "a\n"), WithTopic("replay"))
+	a.NoError(err)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = in.Consumer(canceled)
+	a.ErrorIs(err, context.Canceled)
+	a.NoError(in.Close(ctx))
+	_, err = in.Consumer(ctx)
+	a.ErrorIs(err, core.ErrInputClosed)
+}
+
+type order struct {
+	ID int `json:"id"`
+}
+
+func TestInputPipeline(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	in, err := NewInput(writeFile(t, "{\"id\":1}\n{\"id\":2}\n\n{\"id\":3}\n"))
+	a.NoError(err)
+	output := memory.NewOutput()
+	k := kq.NewKQ(ctx).
+		SetInput(ctx, in).
+		SetExtractor(ctx, kqjson.NewExtractor[order](ctx, kqjson.WithIDField("id"))).
+		SetTransformer(ctx, transformer.Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+			return message.ID(), nil
+		})).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	a.NoError(output.Wait(ctx, 3))
+	a.NoError(k.Close(ctx))
+
+	a.ElementsMatch([]interface{}{"1", "2", "3"}, output.Values())
+	a.Equal(int64(3), in.Committed())
+}
@@ -0,0 +1,26 @@
+package file
+
+const (
+	defaultMaxLineSize = 1024 * 1024
+)
+
+type options struct {
+	topic       string
+	maxLineSize int
+}
+
+type Option func(*options)
+
+// WithTopic sets the topic of the replayed messages
+func WithTopic(topic string) Option {
+	return func(o *options) {
+		o.topic = topic
+	}
+}
+
+// WithMaxLineSize sets the longest line which can be read, 1MB by default, a longer line ends the input
+func WithMaxLineSize(maxLineSize int) Option {
+	return func(o *options) {
+		o.maxLineSize = maxLineSize
+	}
+}
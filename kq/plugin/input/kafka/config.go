@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+// Config is the configuration of the "kafka" input of configured pipelines.
+type Config struct {
+	Brokers  []string `yaml:"brokers" json:"brokers"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	GroupID  string   `yaml:"group_id" json:"group_id"`
+	Topics   []string `yaml:"topics" json:"topics"`
+	// Version is the kafka protocol version, e.g. 2.8.0.
+	Version string `yaml:"version" json:"version"`
+	// InitialOffset is where a new group starts, newest or oldest.
+	InitialOffset      string `yaml:"initial_offset" json:"initial_offset"`
+	MessageChannelSize int    `yaml:"message_channel_size" json:"message_channel_size"`
+	SASLPlainText      bool   `yaml:"sasl_plaintext" json:"sasl_plaintext"`
+	ReadCommitted      bool   `yaml:"read_committed" json:"read_committed"`
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, the default.
+	SASLMechanism string              `yaml:"sasl_mechanism" json:"sasl_mechanism"`
+	TLS           pkgxkafka.TLSConfig `yaml:"tls" json:"tls"`
+}
+
+func init() {
+	core.RegisterInput("kafka", func(ctx context.Context, config core.PluginConfig) (core.Input, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if len(c.Brokers) == 0 || c.GroupID == "" || len(c.Topics) == 0 {
+			return nil, errors.New("kafka input: brokers, group_id and topics are required")
+		}
+		var opts []Option
+		if c.Version != "" {
+			version, err := sarama.ParseKafkaVersion(c.Version)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithVersion(version))
+		}
+		switch c.InitialOffset {
+		case "":
+		case "newest":
+			opts = append(opts, WithInitialOffset(sarama.OffsetNewest))
+		case "oldest":
+			opts = append(opts, WithInitialOffset(sarama.OffsetOldest))
+		default:
+			return nil, fmt.Errorf("kafka input: invalid initial_offset %q", c.InitialOffset)
+		}
+		if c.MessageChannelSize > 0 {
+			opts = append(opts, WithMessageChannelSize(c.MessageChannelSize))
+		}
+		if c.SASLPlainText {
+			opts = append(opts, WithSASLPlainText())
+		}
+		securityOpts, err := pkgxkafka.SecurityOptions(c.SASLMechanism, &c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKafkaOptions(securityOpts...))
+		if c.ReadCommitted {
+			opts = append(opts, WithReadCommitted())
+		}
+		return NewInput(ctx, c.Brokers, c.Username, c.Password, c.GroupID, c.Topics, opts...)
+	})
+}
@@ -2,30 +2,291 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
 	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	_ core.Input           = (*consumer)(nil)
+	_ core.HighWaterMarker = (*consumer)(nil)
+	_ core.Pausable        = (*consumer)(nil)
+	_ core.Rewinder        = (*consumer)(nil)
 )
 
-func NewInput(ctx context.Context) (core.Input, error) {
-	return newConsumer(), nil
+var (
+	ErrInputClosed = core.ErrInputClosed
+)
+
+// NewInput returns a core.Input which consumes topics as a member of the groupID consumer group.
+func NewInput(ctx context.Context, brokers []string, username, password, groupID string,
+	topics []string, opts ...Option) (core.Input, error) {
+	o := &options{
+		messageChannelSize: defaultMessageChannelSize,
+		errorHandler: func(err error) {
+			fmt.Printf("kq kafka input got errors. err=[%v]\n", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	config := pkgxkafka.NewConsumerConfig(username, password, o.kafkaOptions...)
+	config.Consumer.IsolationLevel = o.isolationLevel
+	client, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	if err != nil {
+		return nil, err
+	}
+	return newConsumer(client, topics, o), nil
 }
 
 type consumer struct {
+	client       sarama.ConsumerGroup
+	topics       []string
+	errorHandler func(err error)
+
+	messages chan *sarama.ConsumerMessage
+	session  sessionHolder
+
+	hwmMu          sync.RWMutex
+	highWaterMarks map[string]map[int32]int64
+
+	pauseMu sync.Mutex
+	paused  bool
+
+	// roundMu is held by Rewind so the group is not rejoined before the buffered messages are dropped.
+	roundMu      sync.Mutex
+	roundCancel  context.CancelFunc
+	roundStopped chan struct{}
+
+	cancel    context.CancelFunc
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
-func newConsumer() *consumer {
-	return &consumer{}
+func newConsumer(client sarama.ConsumerGroup, topics []string, o *options) *consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &consumer{
+		client:       client,
+		topics:       topics,
+		errorHandler: o.errorHandler,
+		messages:     make(chan *sarama.ConsumerMessage, o.messageChannelSize),
+		cancel:       cancel,
+		closed:       make(chan struct{}),
+
+		highWaterMarks: make(map[string]map[int32]int64),
+	}
+	c.wg.Add(2)
+	go c.listenErrors()
+	go c.consume(ctx)
+	return c
 }
 
+// Consumer blocks until a claimed message is available, ctx is done or the input is closed.
 func (c *consumer) Consumer(ctx context.Context) (*core.InputMessage, error) {
-	m := core.NewInputMessage()
-	return m, nil
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, ErrInputClosed
+	case raw := <-c.messages:
+		m := core.NewInputMessage()
+		m.Raw = raw
+		return m, nil
+	}
+}
+
+// CommitMessage marks the message offset in the current group session,
+// sarama commits marked offsets periodically and when the session ends.
+func (c *consumer) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+	if inputMessage == nil || inputMessage.Raw == nil {
+		return nil
+	}
+	session := c.session.load()
+	if session == nil {
+		return nil
+	}
+	session.MarkMessage(inputMessage.Raw, "")
+	return nil
 }
 
 func (c *consumer) Close(ctx context.Context) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.cancel()
+		err = c.client.Close()
+		c.wg.Wait()
+	})
+	return err
+}
+
+func (c *consumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.session.store(session)
 	return nil
 }
 
-func (c *consumer) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+func (c *consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	c.session.compareAndClear(session)
+	return nil
+}
+
+func (c *consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	c.pauseClaim(claim)
+	for {
+		select {
+		case raw, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			c.storeHighWaterMark(claim.Topic(), claim.Partition(), claim.HighWaterMarkOffset())
+			select {
+			case c.messages <- raw:
+			case <-session.Context().Done():
+				return nil
+			}
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Pause stops fetching every claimed partition, partitions claimed after a rebalance start paused.
+func (c *consumer) Pause(ctx context.Context) error {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	c.paused = true
+	c.client.PauseAll()
 	return nil
 }
+
+// Resume restarts fetching every claimed partition.
+func (c *consumer) Resume(ctx context.Context) error {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	c.paused = false
+	c.client.ResumeAll()
+	return nil
+}
+
+// pauseClaim pauses a partition claimed while the input is paused,
+// sarama only creates its partition consumer after Setup so PauseAll missed it.
+func (c *consumer) pauseClaim(claim sarama.ConsumerGroupClaim) {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.paused {
+		c.client.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+}
+
+// HighWaterMarks returns the last high water mark seen for every claimed partition.
+func (c *consumer) HighWaterMarks() map[string]map[int32]int64 {
+	c.hwmMu.RLock()
+	defer c.hwmMu.RUnlock()
+	highWaterMarks := make(map[string]map[int32]int64, len(c.highWaterMarks))
+	for topic, partitions := range c.highWaterMarks {
+		copied := make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			copied[partition] = offset
+		}
+		highWaterMarks[topic] = copied
+	}
+	return highWaterMarks
+}
+
+func (c *consumer) storeHighWaterMark(topic string, partition int32, offset int64) {
+	c.hwmMu.Lock()
+	defer c.hwmMu.Unlock()
+	partitions, ok := c.highWaterMarks[topic]
+	if !ok {
+		partitions = make(map[int32]int64)
+		c.highWaterMarks[topic] = partitions
+	}
+	partitions[partition] = offset
+}
+
+// consume joins the group and rejoins after every rebalance or Rewind until ctx is cancelled.
+func (c *consumer) consume(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		roundCtx, cancel := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		c.roundMu.Lock()
+		c.roundCancel, c.roundStopped = cancel, stopped
+		c.roundMu.Unlock()
+		err := c.client.Consume(roundCtx, c.topics, c)
+		cancel()
+		close(stopped)
+		if err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			c.errorHandler(err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Rewind ends the group session, drops the buffered messages and rejoins the group,
+// so the messages after the committed offsets are consumed again.
+func (c *consumer) Rewind(ctx context.Context) error {
+	c.roundMu.Lock()
+	defer c.roundMu.Unlock()
+	cancel, stopped := c.roundCancel, c.roundStopped
+	if cancel != nil {
+		cancel()
+		select {
+		case <-stopped:
+		case <-c.closed:
+			return ErrInputClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for {
+		select {
+		case <-c.messages:
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *consumer) listenErrors() {
+	defer c.wg.Done()
+	for err := range c.client.Errors() {
+		c.errorHandler(err)
+	}
+}
+
+type sessionHolder struct {
+	mu      sync.RWMutex
+	session sarama.ConsumerGroupSession
+}
+
+func (h *sessionHolder) store(session sarama.ConsumerGroupSession) {
+	h.mu.Lock()
+	h.session = session
+	h.mu.Unlock()
+}
+
+func (h *sessionHolder) load() sarama.ConsumerGroupSession {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.session
+}
+
+func (h *sessionHolder) compareAndClear(session sarama.ConsumerGroupSession) {
+	h.mu.Lock()
+	if h.session == session {
+		h.session = nil
+	}
+	h.mu.Unlock()
+}
@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestInput(t *testing.T, broker *sarama.MockBroker) *consumer {
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("in", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("in", 0, sarama.OffsetOldest, 0).
+			SetOffset("in", 0, sarama.OffsetNewest, 2),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"HeartbeatRequest": sarama.NewMockHeartbeatResponse(t),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).SetGroupProtocol(sarama.RangeBalanceStrategyName),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(
+			&sarama.ConsumerGroupMemberAssignment{Topics: map[string][]int32{"in": {0}}}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "in", 0, 0, "", sarama.ErrNoError).
+			SetError(sarama.ErrNoError),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).
+			SetMessage("in", 0, 0, sarama.StringEncoder("a")).
+			SetMessage("in", 0, 1, sarama.StringEncoder("b")).
+			SetHighWaterMark("in", 0, 2),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+	})
+	input, err := NewInput(context.Background(), []string{broker.Addr()}, "", "", "group", []string{"in"},
+		WithKafkaOptions(pkgxkafka.WithVersion(sarama.V2_0_0_0)),
+		WithErrorHandler(func(err error) {
+			t.Log(err)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input.(*consumer)
+}
+
+func consumeValue(t *testing.T, c *consumer) *core.InputMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m, err := c.Consumer(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestConsumerCommitMessage(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	c := newTestInput(t, broker)
+
+	first := consumeValue(t, c)
+	a.Equal("a", string(first.Raw.Value))
+	a.NoError(c.CommitMessage(ctx, first))
+	a.Equal("b", string(consumeValue(t, c).Raw.Value))
+	a.Equal(map[string]map[int32]int64{"in": {0: 2}}, c.HighWaterMarks())
+	a.NoError(c.Close(ctx))
+
+	_, err := c.Consumer(ctx)
+	a.ErrorIs(err, ErrInputClosed)
+	var committed []int64
+	for _, request := range requestsOf[*sarama.OffsetCommitRequest](broker) {
+		if offset, _, err := request.Offset("in", 0); err == nil {
+			committed = append(committed, offset)
+		}
+	}
+	a.NotEmpty(committed)
+	a.Equal(int64(1), committed[len(committed)-1], "only the committed message is marked")
+}
+
+func TestConsumerRewind(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	c := newTestInput(t, broker)
+	defer func() {
+		a.NoError(c.Close(ctx))
+	}()
+
+	a.Equal("a", string(consumeValue(t, c).Raw.Value))
+	a.NoError(c.Rewind(ctx))
+	a.Equal("a", string(consumeValue(t, c).Raw.Value), "the uncommitted messages are consumed again")
+	a.Len(requestsOf[*sarama.JoinGroupRequest](broker), 2)
+}
+
+func TestConsumerPause(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	c := newTestInput(t, broker)
+	defer func() {
+		a.NoError(c.Close(ctx))
+	}()
+
+	a.NoError(c.Pause(ctx))
+	a.NoError(c.Rewind(ctx))
+	consumeCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err := c.Consumer(consumeCtx)
+	a.ErrorIs(err, context.DeadlineExceeded, "a partition claimed while paused is not fetched")
+
+	a.NoError(c.Resume(ctx))
+	a.Equal("a", string(consumeValue(t, c).Raw.Value))
+}
+
+func requestsOf[T any](broker *sarama.MockBroker) []T {
+	var requests []T
+	for _, rr := range broker.History() {
+		if request, ok := rr.Request.(T); ok {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
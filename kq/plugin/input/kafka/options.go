@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	defaultMessageChannelSize = 256
+)
+
+type options struct {
+	kafkaOptions       []pkgxkafka.Option
+	messageChannelSize int
+	errorHandler       func(err error)
+	isolationLevel     sarama.IsolationLevel
+}
+
+type Option func(*options)
+
+// WithKafkaOptions applies options of the kafka package to the consumer config, e.g. kafka.WithTLS
+func WithKafkaOptions(kafkaOptions ...pkgxkafka.Option) Option {
+	return func(o *options) {
+		o.kafkaOptions = append(o.kafkaOptions, kafkaOptions...)
+	}
+}
+
+// WithSASLPlainText use SASLTypePlaintext instead of SCRAM-SHA-512
+func WithSASLPlainText() Option {
+	return WithKafkaOptions(pkgxkafka.WithSASLPlainText())
+}
+
+// WithVersion sets the kafka protocol version, it takes precedence over the version SASL needs
+func WithVersion(version sarama.KafkaVersion) Option {
+	return WithKafkaOptions(pkgxkafka.WithVersion(version))
+}
+
+// WithInitialOffset sets where a new group starts, sarama.OffsetNewest or sarama.OffsetOldest
+func WithInitialOffset(initialOffset int64) Option {
+	return WithKafkaOptions(pkgxkafka.WithInitialOffset(initialOffset))
+}
+
+// WithMessageChannelSize sets how many claimed messages are buffered before Consumer is called
+func WithMessageChannelSize(messageChannelSize int) Option {
+	return func(o *options) {
+		o.messageChannelSize = messageChannelSize
+	}
+}
+
+// WithConsumerInterceptors ...
+func WithConsumerInterceptors(consumerInterceptors []sarama.ConsumerInterceptor) Option {
+	return WithKafkaOptions(pkgxkafka.WithConsumerInterceptors(consumerInterceptors))
+}
+
+// WithErrorHandler receives the errors reported by the consumer group
+func WithErrorHandler(errorHandler func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = errorHandler
+	}
+}
+
+// WithReadCommitted only consumes the messages of committed transactions, needed by exactly-once pipelines
+func WithReadCommitted() Option {
+	return func(o *options) {
+		o.isolationLevel = sarama.ReadCommitted
+	}
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	defaultTopic = "memory"
+)
+
+var _ core.Input = (*Input)(nil)
+
+// Input consumes messages from a channel, it is meant for tests and local runs.
+// Consumer returns core.ErrInputClosed once the channel is closed and drained or the input is closed.
+type Input struct {
+	messages <-chan *sarama.ConsumerMessage
+
+	mu        sync.Mutex
+	committed map[string]map[int32]int64
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewInput returns an Input reading messages until the channel is closed.
+func NewInput(messages <-chan *sarama.ConsumerMessage) *Input {
+	return &Input{
+		messages:  messages,
+		committed: make(map[string]map[int32]int64),
+		closed:    make(chan struct{}),
+	}
+}
+
+// NewInputFromSlice returns an Input which consumes messages in order and is then exhausted.
+func NewInputFromSlice(messages []*sarama.ConsumerMessage) *Input {
+	ch := make(chan *sarama.ConsumerMessage, len(messages))
+	for _, message := range messages {
+		ch <- message
+	}
+	close(ch)
+	return NewInput(ch)
+}
+
+// Messages builds messages on partition 0 of topic with consecutive offsets,
+// the "memory" topic is used when topic is empty.
+func Messages(topic string, values ...[]byte) []*sarama.ConsumerMessage {
+	if topic == "" {
+		topic = defaultTopic
+	}
+	messages := make([]*sarama.ConsumerMessage, 0, len(values))
+	for i, value := range values {
+		messages = append(messages, &sarama.ConsumerMessage{Topic: topic, Offset: int64(i), Value: value})
+	}
+	return messages
+}
+
+func (in *Input) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-in.closed:
+		return nil, core.ErrInputClosed
+	case raw, ok := <-in.messages:
+		if !ok {
+			return nil, core.ErrInputClosed
+		}
+		m := core.NewInputMessage()
+		m.Raw = raw
+		return m, nil
+	}
+}
+
+func (in *Input) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+	if inputMessage == nil || inputMessage.Raw == nil {
+		return nil
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	partitions, ok := in.committed[inputMessage.Raw.Topic]
+	if !ok {
+		partitions = make(map[int32]int64)
+		in.committed[inputMessage.Raw.Topic] = partitions
+	}
+	partitions[inputMessage.Raw.Partition] = inputMessage.Raw.Offset
+	return nil
+}
+
+// Committed returns the last committed offset of every topic-partition.
+func (in *Input) Committed() map[string]map[int32]int64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	committed := make(map[string]map[int32]int64, len(in.committed))
+	for topic, partitions := range in.committed {
+		copied := make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			copied[partition] = offset
+		}
+		committed[topic] = copied
+	}
+	return committed
+}
+
+func (in *Input) Close(ctx context.Context) error {
+	in.closeOnce.Do(func() {
+		close(in.closed)
+	})
+	return nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq"
+	"github.com/colinrs/pkgx/kq/core"
+	kqjson "github.com/colinrs/pkgx/kq/plugin/extractor/json"
+	"github.com/colinrs/pkgx/kq/plugin/output/memory"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	ID     int `json:"id"`
+	Amount int `json:"amount"`
+}
+
+type doubler struct{}
+
+func (d *doubler) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	value, _ := kqjson.Value[order](message)
+	value.Amount *= 2
+	return &core.OutputMessage{Ctx: message.Ctx(), Data: value}, nil
+}
+
+func (d *doubler) OnDone(ctx context.Context, message core.Message) {}
+
+func (d *doubler) OnError(ctx context.Context, message core.Message, err error) {}
+
+func TestPipeline(t *testing.T) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	input := NewInputFromSlice(Messages("orders",
+		[]byte(`{"id":1,"amount":1}`), []byte(`{"id":2,"amount":2}`), []byte(`{"id":3,"amount":3}`)))
+	output := memory.NewOutput()
+	k := kq.NewKQ(ctx).
+		SetInput(ctx, input).
+		SetExtractor(ctx, kqjson.NewExtractor[order](ctx, kqjson.WithIDField("id"))).
+		SetTransformer(ctx, &doubler{}).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	a.NoError(output.Wait(ctx, 3))
+	a.NoError(k.Close(ctx))
+
+	a.ElementsMatch([]interface{}{order{1, 2}, order{2, 4}, order{3, 6}}, output.Values())
+	a.Equal(map[string]map[int32]int64{"orders": {0: 2}}, input.Committed())
+}
+
+func TestInputClose(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	input := NewInput(make(chan *sarama.ConsumerMessage))
+	a.NoError(input.Close(ctx))
+	_, err := input.Consumer(ctx)
+	a.ErrorIs(err, core.ErrInputClosed)
+	a.NoError(input.Close(ctx))
+}
@@ -1 +1,79 @@
 package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/utils"
+)
+
+// Recover turns a panic in the wrapped stage into an error, so the message goes
+// through OnError and the dead letter instead of killing the stage goroutine.
+func Recover() core.Middleware {
+	return func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("kq %s stage panic: %v, stack:%s", message.Stage, p, utils.Stack())
+				}
+			}()
+			return next(ctx, message)
+		}
+	}
+}
+
+// Filter drops the messages for which keep returns false, they are acked without going further.
+func Filter(keep func(ctx context.Context, message *core.StageMessage) bool) core.Middleware {
+	return func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			if !keep(ctx, message) {
+				return nil
+			}
+			return next(ctx, message)
+		}
+	}
+}
+
+// Observe reports the duration and the result of every stage call, e.g. to record metrics.
+func Observe(observe func(ctx context.Context, message *core.StageMessage, duration time.Duration, err error)) core.Middleware {
+	return func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			start := time.Now()
+			err := next(ctx, message)
+			observe(ctx, message, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// WithContext replaces the context handed to the stage, e.g. to start a tracing span.
+// The returned finish func, when not nil, is called with the stage result.
+func WithContext(start func(ctx context.Context, message *core.StageMessage) (context.Context, func(err error))) core.Middleware {
+	return func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			ctx, finish := start(ctx, message)
+			err := next(ctx, message)
+			if finish != nil {
+				finish(err)
+			}
+			return err
+		}
+	}
+}
+
+// Stages applies middleware to the given stages only, e.g. core.StageOutput.
+func Stages(middleware core.Middleware, stages ...string) core.Middleware {
+	return func(next core.Handler) core.Handler {
+		wrapped := middleware(next)
+		return func(ctx context.Context, message *core.StageMessage) error {
+			for _, stage := range stages {
+				if message.Stage == stage {
+					return wrapped(ctx, message)
+				}
+			}
+			return next(ctx, message)
+		}
+	}
+}
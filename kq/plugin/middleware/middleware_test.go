@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	a := assert.New(t)
+	var calls []string
+	trace := func(name string) core.Middleware {
+		return func(next core.Handler) core.Handler {
+			return func(ctx context.Context, message *core.StageMessage) error {
+				calls = append(calls, name)
+				return next(ctx, message)
+			}
+		}
+	}
+	var observed error
+	handler := core.Chain(
+		trace("outer"),
+		Observe(func(ctx context.Context, message *core.StageMessage, duration time.Duration, err error) {
+			observed = err
+		}),
+		Recover(),
+		Stages(trace("output-only"), core.StageOutput),
+	)(func(ctx context.Context, message *core.StageMessage) error {
+		calls = append(calls, "handler")
+		panic("boom")
+	})
+
+	err := handler(context.Background(), &core.StageMessage{Stage: core.StageTransformer})
+	a.Error(err)
+	a.Equal(err, observed)
+	a.Equal([]string{"outer", "handler"}, calls)
+
+	calls = nil
+	_ = handler(context.Background(), &core.StageMessage{Stage: core.StageOutput})
+	a.Equal([]string{"outer", "output-only", "handler"}, calls)
+}
+
+func TestFilter(t *testing.T) {
+	a := assert.New(t)
+	called := false
+	handler := Filter(func(ctx context.Context, message *core.StageMessage) bool {
+		return message.Stage != core.StageExtractor
+	})(func(ctx context.Context, message *core.StageMessage) error {
+		called = true
+		return errors.New("x")
+	})
+	a.NoError(handler(context.Background(), &core.StageMessage{Stage: core.StageExtractor}))
+	a.False(called)
+	a.Error(handler(context.Background(), &core.StageMessage{Stage: core.StageOutput}))
+	a.True(called)
+}
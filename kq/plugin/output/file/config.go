@@ -0,0 +1,26 @@
+package file
+
+import (
+	"context"
+	"errors"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Config is the configuration of the "file" output of configured pipelines.
+type Config struct {
+	Path string `yaml:"path" json:"path"`
+}
+
+func init() {
+	core.RegisterOutput("file", func(ctx context.Context, config core.PluginConfig) (core.Output, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if c.Path == "" {
+			return nil, errors.New("file output: path is required")
+		}
+		return NewOutput(c.Path)
+	})
+}
@@ -0,0 +1,39 @@
+package file
+
+import (
+	"context"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Encoder converts OutputMessage.Data into a single line, without the trailing newline.
+type Encoder func(data interface{}) ([]byte, error)
+
+type options struct {
+	encoder Encoder
+	onDone  func(ctx context.Context, message *core.OutputMessage)
+	onError func(ctx context.Context, message *core.OutputMessage, err error)
+}
+
+type Option func(*options)
+
+// WithEncoder sets how OutputMessage.Data is written, Encode by default
+func WithEncoder(encoder Encoder) Option {
+	return func(o *options) {
+		o.encoder = encoder
+	}
+}
+
+// WithOnDone is called after a message has been written
+func WithOnDone(onDone func(ctx context.Context, message *core.OutputMessage)) Option {
+	return func(o *options) {
+		o.onDone = onDone
+	}
+}
+
+// WithOnError is called when a message could not be written
+func WithOnError(onError func(ctx context.Context, message *core.OutputMessage, err error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
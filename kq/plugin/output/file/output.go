@@ -0,0 +1,119 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+var _ core.BatchOutput = (*Output)(nil)
+
+var (
+	ErrNewline = errors.New("file output: encoded message contains a newline")
+)
+
+// Output appends every message to a newline-delimited file which the file input can replay.
+type Output struct {
+	encoder Encoder
+	onDone  func(ctx context.Context, message *core.OutputMessage)
+	onError func(ctx context.Context, message *core.OutputMessage, err error)
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// NewOutput opens path for appending, creating it when missing.
+func NewOutput(path string, opts ...Option) (*Output, error) {
+	o := &options{
+		encoder: Encode,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		encoder: o.encoder,
+		onDone:  o.onDone,
+		onError: o.onError,
+		file:    f,
+		writer:  bufio.NewWriter(f),
+	}, nil
+}
+
+func (out *Output) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	return out.SendOutputs(ctx, []*core.OutputMessage{message})
+}
+
+// SendOutputs writes the messages and flushes them, nothing is written when one cannot be encoded.
+func (out *Output) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	lines := make([][]byte, 0, len(messages))
+	for _, message := range messages {
+		line, err := out.encoder(message.Data)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(line, '\n') >= 0 {
+			return ErrNewline
+		}
+		lines = append(lines, line)
+	}
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	for _, line := range lines {
+		if _, err := out.writer.Write(line); err != nil {
+			return err
+		}
+		if err := out.writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return out.writer.Flush()
+}
+
+func (out *Output) OnDone(cxt context.Context, message *core.OutputMessage) {
+	if out.onDone != nil {
+		out.onDone(cxt, message)
+	}
+}
+
+func (out *Output) OnError(cxt context.Context, message *core.OutputMessage, err error) {
+	if out.onError != nil {
+		out.onError(cxt, message, err)
+	}
+}
+
+func (out *Output) Close(ctx context.Context) error {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.file == nil {
+		return nil
+	}
+	err := out.writer.Flush()
+	if closeErr := out.file.Close(); err == nil {
+		err = closeErr
+	}
+	out.file = nil
+	return err
+}
+
+// Encode writes bytes and strings as is and marshals everything else to JSON.
+func Encode(data interface{}) ([]byte, error) {
+	switch v := data.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return json.Marshal(v)
+	}
+}
@@ -0,0 +1,47 @@
+package file
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/input/file"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputReplay(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "captured.jsonl")
+	out, err := NewOutput(path)
+	a.NoError(err)
+	a.NoError(out.SendOutput(ctx, &core.OutputMessage{Data: map[string]int{"id": 1}}))
+	a.NoError(out.SendOutputs(ctx, []*core.OutputMessage{{Data: "two"}, {Data: []byte("")}, {Data: []byte("3")}}))
+	a.ErrorIs(out.SendOutput(ctx, &core.OutputMessage{Data: "a\nb"}), ErrNewline)
+	a.NoError(out.Close(ctx))
+	a.NoError(out.Close(ctx))
+
+	in, err := file.NewInput(path, file.WithTopic("replay"))
+	a.NoError(err)
+	var values []string
+	var offsets []int64
+	for {
+		m, err := in.Consumer(ctx)
+		if err != nil {
+			a.ErrorIs(err, core.ErrInputClosed)
+			break
+		}
+		a.Equal("replay", m.Raw.Topic)
+		values = append(values, string(m.Raw.Value))
+		offsets = append(offsets, m.Raw.Offset)
+		a.NoError(in.CommitMessage(ctx, m))
+	}
+	a.Equal([]string{`{"id":1}`, "two", "3"}, values)
+	a.Equal([]int64{0, 1, 3}, offsets)
+	a.Equal(int64(3), in.Committed())
+	a.NoError(in.Close(ctx))
+	_, err = in.Consumer(ctx)
+	a.ErrorIs(err, core.ErrInputClosed)
+}
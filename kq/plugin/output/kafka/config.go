@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+// Config is the configuration of the "kafka" output of configured pipelines.
+type Config struct {
+	Brokers  []string `yaml:"brokers" json:"brokers"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	Topic    string   `yaml:"topic" json:"topic"`
+	// Version is the kafka protocol version, e.g. 2.8.0.
+	Version string `yaml:"version" json:"version"`
+	// RequiredAcks is 0, 1 or -1 for all the in-sync replicas.
+	RequiredAcks  *sarama.RequiredAcks `yaml:"required_acks" json:"required_acks"`
+	SASLPlainText bool                 `yaml:"sasl_plaintext" json:"sasl_plaintext"`
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, the default.
+	SASLMechanism string              `yaml:"sasl_mechanism" json:"sasl_mechanism"`
+	TLS           pkgxkafka.TLSConfig `yaml:"tls" json:"tls"`
+	// TransactionalID and GroupID enable exactly-once mode, see WithTransaction.
+	TransactionalID string `yaml:"transactional_id" json:"transactional_id"`
+	GroupID         string `yaml:"group_id" json:"group_id"`
+}
+
+func init() {
+	core.RegisterOutput("kafka", func(ctx context.Context, config core.PluginConfig) (core.Output, error) {
+		c := &Config{}
+		if err := config.Decode(c); err != nil {
+			return nil, err
+		}
+		if len(c.Brokers) == 0 {
+			return nil, errors.New("kafka output: brokers are required")
+		}
+		var opts []Option
+		if c.Topic != "" {
+			opts = append(opts, WithTopic(c.Topic))
+		}
+		if c.Version != "" {
+			version, err := sarama.ParseKafkaVersion(c.Version)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithVersion(version))
+		}
+		if c.RequiredAcks != nil {
+			opts = append(opts, WithRequiredAcks(*c.RequiredAcks))
+		}
+		if c.SASLPlainText {
+			opts = append(opts, WithSASLPlainText())
+		}
+		securityOpts, err := pkgxkafka.SecurityOptions(c.SASLMechanism, &c.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKafkaOptions(securityOpts...))
+		if c.TransactionalID != "" {
+			opts = append(opts, WithTransaction(c.TransactionalID, c.GroupID))
+		}
+		return NewOutput(ctx, c.Brokers, c.Username, c.Password, opts...)
+	})
+}
@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"context"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+)
+
+// Route decides where a single output message is produced.
+type Route struct {
+	Topic   string
+	Key     string
+	Headers []sarama.RecordHeader
+}
+
+// Router picks the Route of every output message, an empty Topic falls back to the default topic.
+type Router func(ctx context.Context, message *core.OutputMessage) (*Route, error)
+
+type options struct {
+	kafkaOptions    []pkgxkafka.Option
+	topic           string
+	router          Router
+	onDone          func(ctx context.Context, message *core.OutputMessage)
+	onError         func(ctx context.Context, message *core.OutputMessage, err error)
+	transactionalID string
+	groupID         string
+}
+
+type Option func(*options)
+
+// WithKafkaOptions applies options of the kafka package to the producer config, e.g. kafka.WithTLS
+func WithKafkaOptions(kafkaOptions ...pkgxkafka.Option) Option {
+	return func(o *options) {
+		o.kafkaOptions = append(o.kafkaOptions, kafkaOptions...)
+	}
+}
+
+// WithSASLPlainText use SASLTypePlaintext instead of SCRAM-SHA-512
+func WithSASLPlainText() Option {
+	return WithKafkaOptions(pkgxkafka.WithSASLPlainText())
+}
+
+// WithVersion sets the kafka protocol version
+func WithVersion(version sarama.KafkaVersion) Option {
+	return WithKafkaOptions(pkgxkafka.WithVersion(version))
+}
+
+// WithRequiredAcks sets the acks the broker must receive before a send succeeds
+func WithRequiredAcks(requiredAcks sarama.RequiredAcks) Option {
+	return WithKafkaOptions(pkgxkafka.WithRequiredAcks(requiredAcks))
+}
+
+// WithTopic sets the default topic used when the router does not pick one
+func WithTopic(topic string) Option {
+	return func(o *options) {
+		o.topic = topic
+	}
+}
+
+// WithRouter sets the function choosing topic, key and headers per message
+func WithRouter(router Router) Option {
+	return func(o *options) {
+		o.router = router
+	}
+}
+
+// WithProducerInterceptors ...
+func WithProducerInterceptors(producerInterceptors []sarama.ProducerInterceptor) Option {
+	return WithKafkaOptions(pkgxkafka.WithProducerInterceptors(producerInterceptors))
+}
+
+// WithOnDone is called after a message has been produced
+func WithOnDone(onDone func(ctx context.Context, message *core.OutputMessage)) Option {
+	return func(o *options) {
+		o.onDone = onDone
+	}
+}
+
+// WithOnError is called when a message could not be produced
+func WithOnError(onError func(ctx context.Context, message *core.OutputMessage, err error)) Option {
+	return func(o *options) {
+		o.onError = onError
+	}
+}
+
+// WithTransaction makes the producer transactional so kq can run in exactly-once mode,
+// the input offsets are committed for groupID, the consumer group of the kafka input
+func WithTransaction(transactionalID, groupID string) Option {
+	return func(o *options) {
+		o.transactionalID = transactionalID
+		o.groupID = groupID
+	}
+}
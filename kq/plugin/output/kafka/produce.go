@@ -2,48 +2,166 @@ package kafka
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
 
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
 	"github.com/colinrs/pkgx/kq/core"
 
 	"github.com/IBM/sarama"
 )
 
-func NewOutput(ctx context.Context) (core.Output, error) {
-	return newProducer(), nil
+var (
+	_ core.BatchOutput         = (*producer)(nil)
+	_ core.TransactionalOutput = (*producer)(nil)
+)
+
+var (
+	ErrNoTopic = errors.New("kafka output: no topic routed for message")
+)
+
+// NewOutput returns a core.Output which produces every OutputMessage.Data to kafka.
+func NewOutput(ctx context.Context, brokers []string, username, password string, opts ...Option) (core.Output, error) {
+	o := &options{
+		kafkaOptions: []pkgxkafka.Option{pkgxkafka.WithRequiredAcks(sarama.WaitForAll)},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	client, err := sarama.NewSyncProducer(brokers, newConfig(username, password, o))
+	if err != nil {
+		return nil, err
+	}
+	return newProducer(client, o), nil
+}
+
+func newConfig(username, password string, o *options) *sarama.Config {
+	config := pkgxkafka.NewProducerConfig(username, password, o.kafkaOptions...)
+	if o.transactionalID != "" {
+		config.Producer.Idempotent = true
+		config.Producer.Transaction.ID = o.transactionalID
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+	return config
 }
 
 type producer struct {
-	client sarama.SyncProducer
+	client  sarama.SyncProducer
+	groupID string
+	topic   string
+	router  Router
+	onDone  func(ctx context.Context, message *core.OutputMessage)
+	onError func(ctx context.Context, message *core.OutputMessage, err error)
 }
 
-func newProducer() *producer {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.Return.Successes = true
+func newProducer(client sarama.SyncProducer, o *options) *producer {
+	return &producer{
+		client:  client,
+		groupID: o.groupID,
+		topic:   o.topic,
+		router:  o.router,
+		onDone:  o.onDone,
+		onError: o.onError,
+	}
+}
 
-	client, err := sarama.NewSyncProducer([]string{"127.0.0.1:9092"}, config)
+func (p *producer) SendOutput(ctx context.Context, msg *core.OutputMessage) error {
+	producerMessage, err := p.buildMessage(ctx, msg)
 	if err != nil {
-		return nil
+		return err
 	}
-	return &producer{client: client}
+	_, _, err = p.client.SendMessage(producerMessage)
+	return err
 }
 
-func (p *producer) SendOutput(ctx context.Context, msg *core.OutputMessage) error {
-	producerMessage := &sarama.ProducerMessage{
-		Topic: "shopping",
-		Value: sarama.StringEncoder("20220411happy02"),
-	}
-	partition, offset, err := p.client.SendMessage(producerMessage)
-	fmt.Println("partition:")
-	fmt.Println(partition)
-	fmt.Println("offset:")
-	fmt.Println(offset)
+// SendOutputs produces the messages in a single SendMessages call,
+// a core.PartialError lists the messages which failed.
+func (p *producer) SendOutputs(ctx context.Context, msgs []*core.OutputMessage) error {
+	producerMessages := make([]*sarama.ProducerMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		producerMessage, err := p.buildMessage(ctx, msg)
+		if err != nil {
+			return err
+		}
+		producerMessage.Metadata = msg
+		producerMessages = append(producerMessages, producerMessage)
+	}
+	err := p.client.SendMessages(producerMessages)
+	var producerErrors sarama.ProducerErrors
+	if !errors.As(err, &producerErrors) {
+		return err
+	}
+	failed := make([]*core.OutputMessage, 0, len(producerErrors))
+	for _, producerError := range producerErrors {
+		msg, ok := producerError.Msg.Metadata.(*core.OutputMessage)
+		if !ok {
+			return err
+		}
+		failed = append(failed, msg)
+	}
+	return &core.PartialError{Failed: failed, Err: err}
+}
+
+func (p *producer) buildMessage(ctx context.Context, msg *core.OutputMessage) (*sarama.ProducerMessage, error) {
+	route := &Route{}
+	if p.router != nil {
+		r, err := p.router(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			route = r
+		}
+	}
+	topic := route.Topic
+	if topic == "" {
+		topic = p.topic
+	}
+	if topic == "" {
+		return nil, ErrNoTopic
+	}
+	value, err := Encode(msg.Data)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
+	}
+	producerMessage := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   value,
+		Headers: route.Headers,
+	}
+	if route.Key != "" {
+		producerMessage.Key = sarama.StringEncoder(route.Key)
+	}
+	return producerMessage, nil
+}
+
+func (p *producer) BeginTransaction(ctx context.Context) error {
+	return p.client.BeginTxn()
+}
+
+// CommitTransaction adds the offsets following inputs to the transaction and commits it.
+func (p *producer) CommitTransaction(ctx context.Context, inputs []*core.InputMessage) error {
+	offsets := make(map[string][]*sarama.PartitionOffsetMetadata)
+	for _, input := range inputs {
+		if input.Raw == nil {
+			continue
+		}
+		offsets[input.Raw.Topic] = append(offsets[input.Raw.Topic], &sarama.PartitionOffsetMetadata{
+			Partition: input.Raw.Partition,
+			Offset:    input.Raw.Offset + 1,
+		})
+	}
+	if len(offsets) > 0 {
+		if err := p.client.AddOffsetsToTxn(offsets, p.groupID); err != nil {
+			return err
+		}
 	}
-	return nil
+	return p.client.CommitTxn()
+}
+
+func (p *producer) AbortTransaction(ctx context.Context) error {
+	return p.client.AbortTxn()
 }
 
 func (p *producer) Close(ctx context.Context) error {
@@ -51,8 +169,34 @@ func (p *producer) Close(ctx context.Context) error {
 }
 
 func (p *producer) OnDone(cxt context.Context, message *core.OutputMessage) {
-
+	if p.onDone != nil {
+		p.onDone(cxt, message)
+	}
 }
+
 func (p *producer) OnError(cxt context.Context, message *core.OutputMessage, err error) {
+	if p.onError != nil {
+		p.onError(cxt, message, err)
+	}
+}
 
+// Encode converts OutputMessage.Data into a sarama.Encoder,
+// bytes and strings are sent as is and everything else is marshaled to JSON.
+func Encode(data interface{}) (sarama.Encoder, error) {
+	switch v := data.(type) {
+	case nil:
+		return nil, nil
+	case sarama.Encoder:
+		return v, nil
+	case []byte:
+		return sarama.ByteEncoder(v), nil
+	case string:
+		return sarama.StringEncoder(v), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return sarama.ByteEncoder(b), nil
+	}
 }
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerRoute(t *testing.T) {
+	a := assert.New(t)
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		a.Equal("orders", msg.Topic)
+		key, _ := msg.Key.Encode()
+		a.Equal("42", string(key))
+		value, _ := msg.Value.Encode()
+		a.JSONEq(`{"id":42}`, string(value))
+		return nil
+	})
+	p := newProducer(mock, &options{
+		topic: "default",
+		router: func(ctx context.Context, message *core.OutputMessage) (*Route, error) {
+			return &Route{Topic: "orders", Key: "42"}, nil
+		},
+	})
+	err := p.SendOutput(context.Background(), &core.OutputMessage{Data: map[string]int{"id": 42}})
+	a.NoError(err)
+	a.NoError(p.Close(context.Background()))
+}
+
+func TestProducerSendError(t *testing.T) {
+	a := assert.New(t)
+	mock := mocks.NewSyncProducer(t, nil)
+	sendErr := errors.New("broker down")
+	mock.ExpectSendMessageAndFail(sendErr)
+	var reported error
+	p := newProducer(mock, &options{
+		topic: "default",
+		onError: func(ctx context.Context, message *core.OutputMessage, err error) {
+			reported = err
+		},
+	})
+	msg := &core.OutputMessage{Data: "payload"}
+	err := p.SendOutput(context.Background(), msg)
+	a.ErrorIs(err, sendErr)
+	p.OnError(context.Background(), msg, err)
+	a.ErrorIs(reported, sendErr)
+
+	p.topic = ""
+	a.ErrorIs(p.SendOutput(context.Background(), msg), ErrNoTopic)
+	a.NoError(p.Close(context.Background()))
+}
+
+func TestProducerSendOutputs(t *testing.T) {
+	a := assert.New(t)
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndSucceed()
+	p := newProducer(mock, &options{topic: "default"})
+	err := p.SendOutputs(context.Background(), []*core.OutputMessage{{Data: []byte("a")}, {Data: "b"}})
+	a.NoError(err)
+	a.NoError(p.Close(context.Background()))
+}
+
+// partialSyncProducer fails the second message of every SendMessages call.
+type partialSyncProducer struct {
+	sarama.SyncProducer
+}
+
+func (p *partialSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return sarama.ProducerErrors{{Msg: msgs[1], Err: sarama.ErrNotEnoughReplicas}}
+}
+
+func TestProducerSendOutputsPartialError(t *testing.T) {
+	a := assert.New(t)
+	p := newProducer(&partialSyncProducer{}, &options{topic: "default"})
+	msgs := []*core.OutputMessage{{Data: "a"}, {Data: "b"}, {Data: "c"}}
+	err := p.SendOutputs(context.Background(), msgs)
+	var partialErr *core.PartialError
+	a.True(errors.As(err, &partialErr))
+	a.Equal([]*core.OutputMessage{msgs[1]}, partialErr.Failed)
+}
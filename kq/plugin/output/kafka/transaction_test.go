@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	pkgxkafka "github.com/colinrs/pkgx/kafka"
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTransactionalProducer(t *testing.T, broker *sarama.MockBroker) *producer {
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("out", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorTransaction, "txn", broker).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1}),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{"out": {{Partition: 0}}},
+		}),
+		"ProduceRequest":         sarama.NewMockProduceResponse(t),
+		"AddOffsetsToTxnRequest": sarama.NewMockWrapper(&sarama.AddOffsetsToTxnResponse{}),
+		"TxnOffsetCommitRequest": sarama.NewMockWrapper(&sarama.TxnOffsetCommitResponse{
+			Topics: map[string][]*sarama.PartitionError{"in": {{Partition: 0}}},
+		}),
+		"EndTxnRequest": sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	})
+	o := &options{
+		kafkaOptions:    []pkgxkafka.Option{pkgxkafka.WithVersion(sarama.V0_11_0_0)},
+		topic:           "out",
+		transactionalID: "txn",
+		groupID:         "group",
+	}
+	config := newConfig("", "", o)
+	config.Producer.Retry.Backoff = 0
+	client, err := sarama.NewSyncProducer([]string{broker.Addr()}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newProducer(client, o)
+}
+
+func requestsOf[T any](broker *sarama.MockBroker) []T {
+	var requests []T
+	for _, rr := range broker.History() {
+		if request, ok := rr.Request.(T); ok {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func TestProducerCommitTransaction(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	p := newTransactionalProducer(t, broker)
+
+	a.NoError(p.BeginTransaction(ctx))
+	a.NoError(p.SendOutput(ctx, &core.OutputMessage{Data: "a"}))
+	input := core.NewInputMessage()
+	input.Raw = &sarama.ConsumerMessage{Topic: "in", Partition: 0, Offset: 41}
+	a.NoError(p.CommitTransaction(ctx, []*core.InputMessage{input}))
+	a.NoError(p.Close(ctx))
+
+	a.Len(requestsOf[*sarama.ProduceRequest](broker), 1)
+	offsetCommits := requestsOf[*sarama.TxnOffsetCommitRequest](broker)
+	if a.Len(offsetCommits, 1) {
+		a.Equal("group", offsetCommits[0].GroupID)
+		a.Equal(int64(42), offsetCommits[0].Topics["in"][0].Offset)
+	}
+	endTxns := requestsOf[*sarama.EndTxnRequest](broker)
+	if a.Len(endTxns, 1) {
+		a.True(endTxns[0].TransactionResult)
+	}
+}
+
+func TestProducerAbortTransaction(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	p := newTransactionalProducer(t, broker)
+
+	a.NoError(p.BeginTransaction(ctx))
+	a.NoError(p.SendOutput(ctx, &core.OutputMessage{Data: "a"}))
+	a.NoError(p.AbortTransaction(ctx))
+	a.NoError(p.Close(ctx))
+
+	a.Empty(requestsOf[*sarama.TxnOffsetCommitRequest](broker))
+	endTxns := requestsOf[*sarama.EndTxnRequest](broker)
+	if a.Len(endTxns, 1) {
+		a.False(endTxns[0].TransactionResult)
+	}
+}
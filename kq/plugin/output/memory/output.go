@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+var _ core.BatchOutput = (*Output)(nil)
+
+// Output collects output messages in memory, it is meant for tests and local runs.
+type Output struct {
+	mu       sync.Mutex
+	messages []*core.OutputMessage
+	// received is closed and replaced every time messages are appended.
+	received chan struct{}
+}
+
+func NewOutput() *Output {
+	return &Output{received: make(chan struct{})}
+}
+
+func (o *Output) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	return o.SendOutputs(ctx, []*core.OutputMessage{message})
+}
+
+func (o *Output) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, messages...)
+	close(o.received)
+	o.received = make(chan struct{})
+	return nil
+}
+
+// Messages returns a copy of the messages received so far.
+func (o *Output) Messages() []*core.OutputMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	messages := make([]*core.OutputMessage, len(o.messages))
+	copy(messages, o.messages)
+	return messages
+}
+
+// Values returns the Data of the messages received so far.
+func (o *Output) Values() []interface{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	values := make([]interface{}, 0, len(o.messages))
+	for _, message := range o.messages {
+		values = append(values, message.Data)
+	}
+	return values
+}
+
+// Wait blocks until at least n messages have been received or ctx is done.
+func (o *Output) Wait(ctx context.Context, n int) error {
+	for {
+		o.mu.Lock()
+		count, received := len(o.messages), o.received
+		o.mu.Unlock()
+		if count >= n {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-received:
+		}
+	}
+}
+
+// Reset drops every message received so far.
+func (o *Output) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = nil
+}
+
+func (o *Output) OnDone(cxt context.Context, message *core.OutputMessage) {}
+
+func (o *Output) OnError(cxt context.Context, message *core.OutputMessage, err error) {}
+
+func (o *Output) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutput(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	out := NewOutput()
+	a.NoError(out.Wait(ctx, 0))
+
+	received := make(chan error, 1)
+	go func() {
+		received <- out.Wait(ctx, 3)
+	}()
+	first := &core.OutputMessage{Data: "a"}
+	a.NoError(out.SendOutput(ctx, first))
+	a.NoError(out.SendOutputs(ctx, []*core.OutputMessage{{Data: "b"}, {Data: 3}}))
+	select {
+	case err := <-received:
+		a.NoError(err)
+	case <-time.After(time.Second):
+		a.Fail("Wait did not return")
+	}
+
+	messages := out.Messages()
+	a.Len(messages, 3)
+	a.Same(first, messages[0])
+	messages[0] = nil
+	a.Same(first, out.Messages()[0], "Messages returns a copy")
+	a.Equal([]interface{}{"a", "b", 3}, out.Values())
+
+	out.Reset()
+	a.Empty(out.Values())
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	a.ErrorIs(out.Wait(timeoutCtx, 1), context.DeadlineExceeded)
+	a.NoError(out.Close(ctx))
+}
@@ -0,0 +1,151 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/zeromicro/go-zero/core/errorx"
+)
+
+var _ core.BatchOutput = (*Router)(nil)
+
+var (
+	ErrNoRoute = errors.New("kq router: no route matched the message")
+)
+
+// Route sends the messages for which Match returns true to Output, a nil Match matches everything.
+type Route struct {
+	Match  func(ctx context.Context, message *core.OutputMessage) bool
+	Output core.Output
+}
+
+// Router is a core.Output which sends every message to the Output of the first matching route,
+// messages matching no route fail with ErrNoRoute. It is not a transformer but lives with the
+// combinators since it is their counterpart on the output side, set it with KQ.SetOutput.
+type Router struct {
+	routes []Route
+	// outputs holds the distinct outputs of the routes, outputIndex the index of the output of each route.
+	outputs     []core.Output
+	outputIndex []int
+}
+
+func NewRouter(routes ...Route) *Router {
+	r := &Router{routes: routes, outputIndex: make([]int, len(routes))}
+	for i, route := range routes {
+		r.outputIndex[i] = len(r.outputs)
+		for j, output := range r.outputs {
+			if sameOutput(output, route.Output) {
+				r.outputIndex[i] = j
+				break
+			}
+		}
+		if r.outputIndex[i] == len(r.outputs) {
+			r.outputs = append(r.outputs, route.Output)
+		}
+	}
+	return r
+}
+
+// sameOutput reports whether a and b are the same output, outputs of types which cannot be
+// compared with == are never shared.
+func sameOutput(a, b core.Output) bool {
+	t := reflect.TypeOf(a)
+	return t != nil && t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// route returns the index in r.outputs of the output of the first matching route.
+func (r *Router) route(ctx context.Context, message *core.OutputMessage) (int, error) {
+	for i, route := range r.routes {
+		if route.Match == nil || route.Match(ctx, message) {
+			return r.outputIndex[i], nil
+		}
+	}
+	return 0, ErrNoRoute
+}
+
+func (r *Router) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	i, err := r.route(ctx, message)
+	if err != nil {
+		return err
+	}
+	return r.outputs[i].SendOutput(ctx, message)
+}
+
+// SendOutputs groups the messages by route and sends every group, outputs implementing core.BatchOutput
+// receive their group at once and the others one message at a time. When only some of the messages
+// fail, e.g. because they match no route, a core.PartialError lists them with the first error met.
+func (r *Router) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	var (
+		failed   []*core.OutputMessage
+		firstErr error
+	)
+	fail := func(err error, messages ...*core.OutputMessage) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed = append(failed, messages...)
+	}
+	groups := make([][]*core.OutputMessage, len(r.outputs))
+	for _, message := range messages {
+		i, err := r.route(ctx, message)
+		if err != nil {
+			fail(err, message)
+			continue
+		}
+		groups[i] = append(groups[i], message)
+	}
+	for i, output := range r.outputs {
+		if len(groups[i]) == 0 {
+			continue
+		}
+		batchOutput, ok := output.(core.BatchOutput)
+		if !ok {
+			for _, message := range groups[i] {
+				if err := output.SendOutput(ctx, message); err != nil {
+					fail(err, message)
+				}
+			}
+			continue
+		}
+		err := batchOutput.SendOutputs(ctx, groups[i])
+		var partialErr *core.PartialError
+		switch {
+		case err == nil:
+		case errors.As(err, &partialErr):
+			fail(partialErr.Err, partialErr.Failed...)
+		default:
+			fail(err, groups[i]...)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case len(messages):
+		return firstErr
+	}
+	return &core.PartialError{Failed: failed, Err: firstErr}
+}
+
+func (r *Router) OnDone(cxt context.Context, message *core.OutputMessage) {
+	if i, err := r.route(cxt, message); err == nil {
+		r.outputs[i].OnDone(cxt, message)
+	}
+}
+
+func (r *Router) OnError(cxt context.Context, message *core.OutputMessage, err error) {
+	if i, routeErr := r.route(cxt, message); routeErr == nil {
+		r.outputs[i].OnError(cxt, message, err)
+	}
+}
+
+// Close closes every output once, even when several routes share it.
+func (r *Router) Close(ctx context.Context) error {
+	var batchErr errorx.BatchError
+	for _, output := range r.outputs {
+		batchErr.Add(output.Close(ctx))
+	}
+	return batchErr.Err()
+}
@@ -0,0 +1,146 @@
+package transformer
+
+import (
+	"context"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+// Message is what a transformer of a Chain receives from the previous one,
+// it keeps the ID and the timestamp of the extracted message.
+type Message struct {
+	core.Message
+	ctx  context.Context
+	Data interface{}
+}
+
+func (m *Message) Ctx() context.Context {
+	return m.ctx
+}
+
+// Data returns the Data produced by the previous transformer of a Chain,
+// or the message itself at the head of the chain.
+func Data(message core.Message) interface{} {
+	if m, ok := message.(*Message); ok {
+		return m.Data
+	}
+	return message
+}
+
+type funcTransformer struct {
+	process func(ctx context.Context, message core.Message) (*core.OutputMessage, error)
+}
+
+func (t *funcTransformer) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	return t.process(ctx, message)
+}
+
+func (t *funcTransformer) OnDone(ctx context.Context, message core.Message) {}
+
+func (t *funcTransformer) OnError(ctx context.Context, message core.Message, err error) {}
+
+// Filter passes the messages for which keep returns true as they are and drops the others,
+// dropped messages are acked without reaching the output.
+func Filter(keep func(ctx context.Context, message core.Message) bool) core.Transformer {
+	return &funcTransformer{process: func(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+		if !keep(ctx, message) {
+			return nil, nil
+		}
+		return &core.OutputMessage{Ctx: message.Ctx(), Data: Data(message)}, nil
+	}}
+}
+
+// Map turns every message into the Data of one output message.
+func Map(fn func(ctx context.Context, message core.Message) (interface{}, error)) core.Transformer {
+	return &funcTransformer{process: func(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+		data, err := fn(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		return &core.OutputMessage{Ctx: message.Ctx(), Data: data}, nil
+	}}
+}
+
+// FlatMap turns every message into any number of output messages,
+// the message is acked once all of them completed and dropped when there is none.
+func FlatMap(fn func(ctx context.Context, message core.Message) ([]interface{}, error)) core.Transformer {
+	return &funcTransformer{process: func(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+		values, err := fn(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		children := make([]*core.OutputMessage, 0, len(values))
+		for _, data := range values {
+			children = append(children, &core.OutputMessage{Ctx: message.Ctx(), Data: data})
+		}
+		return &core.OutputMessage{Ctx: message.Ctx(), Children: children}, nil
+	}}
+}
+
+type chain struct {
+	transformers []core.Transformer
+}
+
+// Chain runs the transformers one after the other, each one receives a *Message holding the
+// output of the previous one, see Data. A message dropped by a transformer stops there and the
+// children of a FlatMap go through the rest of the chain one by one.
+func Chain(transformers ...core.Transformer) core.Transformer {
+	return &chain{transformers: transformers}
+}
+
+func (c *chain) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	if len(c.transformers) == 0 {
+		return &core.OutputMessage{Ctx: message.Ctx(), Data: Data(message)}, nil
+	}
+	outputs, err := c.process(ctx, message, c.transformers)
+	if err != nil || len(outputs) == 0 {
+		return nil, err
+	}
+	if len(outputs) == 1 {
+		return outputs[0], nil
+	}
+	return &core.OutputMessage{Ctx: message.Ctx(), Children: outputs}, nil
+}
+
+func (c *chain) process(ctx context.Context, message core.Message,
+	transformers []core.Transformer) ([]*core.OutputMessage, error) {
+	output, err := transformers[0].Process(ctx, message)
+	if err != nil || output == nil {
+		return nil, err
+	}
+	if len(transformers) == 1 {
+		return output.Outputs(), nil
+	}
+	var outputs []*core.OutputMessage
+	for _, child := range output.Outputs() {
+		next := &Message{Message: unwrap(message), ctx: child.Ctx, Data: child.Data}
+		if next.ctx == nil {
+			next.ctx = message.Ctx()
+		}
+		childOutputs, err := c.process(ctx, next, transformers[1:])
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, childOutputs...)
+	}
+	return outputs, nil
+}
+
+func (c *chain) OnDone(ctx context.Context, message core.Message) {
+	for _, transformer := range c.transformers {
+		transformer.OnDone(ctx, message)
+	}
+}
+
+func (c *chain) OnError(ctx context.Context, message core.Message, err error) {
+	for _, transformer := range c.transformers {
+		transformer.OnError(ctx, message, err)
+	}
+}
+
+func unwrap(message core.Message) core.Message {
+	if m, ok := message.(*Message); ok {
+		return m.Message
+	}
+	return message
+}
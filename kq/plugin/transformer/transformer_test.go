@@ -0,0 +1,182 @@
+package transformer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/output/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMessage struct {
+	id  string
+	ctx context.Context
+}
+
+func (m *testMessage) ID() string           { return m.id }
+func (m *testMessage) Timestamp() time.Time { return time.Time{} }
+func (m *testMessage) Ctx() context.Context { return m.ctx }
+
+func words(ctx context.Context, message core.Message) ([]interface{}, error) {
+	var values []interface{}
+	for _, word := range strings.Fields(message.ID()) {
+		values = append(values, word)
+	}
+	return values, nil
+}
+
+func TestChain(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	var ids []string
+	chain := Chain(
+		FlatMap(words),
+		Filter(func(ctx context.Context, message core.Message) bool {
+			ids = append(ids, message.ID())
+			return Data(message) != "skip"
+		}),
+		Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+			return strings.ToUpper(Data(message).(string)), nil
+		}),
+	)
+
+	output, err := chain.Process(ctx, &testMessage{id: "a skip b", ctx: ctx})
+	a.NoError(err)
+	a.Len(output.Children, 2)
+	a.Equal("A", output.Children[0].Data)
+	a.Equal("B", output.Children[1].Data)
+	a.Equal([]string{"a skip b", "a skip b", "a skip b"}, ids)
+
+	output, err = chain.Process(ctx, &testMessage{id: "one", ctx: ctx})
+	a.NoError(err)
+	a.Nil(output.Children)
+	a.Equal("ONE", output.Data)
+
+	output, err = chain.Process(ctx, &testMessage{id: "skip", ctx: ctx})
+	a.NoError(err)
+	a.Nil(output)
+
+	mapErr := errors.New("map")
+	output, err = Chain(FlatMap(words), Map(func(ctx context.Context, message core.Message) (interface{}, error) {
+		return nil, mapErr
+	})).Process(ctx, &testMessage{id: "a b", ctx: ctx})
+	a.ErrorIs(err, mapErr)
+	a.Nil(output)
+}
+
+func TestFlatMapEmpty(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	output, err := FlatMap(words).Process(ctx, &testMessage{ctx: ctx})
+	a.NoError(err)
+	a.Empty(output.Outputs())
+}
+
+func TestRouter(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	numbers, others := memory.NewOutput(), memory.NewOutput()
+	router := NewRouter(
+		Route{Match: func(ctx context.Context, message *core.OutputMessage) bool {
+			_, ok := message.Data.(int)
+			return ok
+		}, Output: numbers},
+		Route{Output: others},
+	)
+	a.NoError(router.SendOutput(ctx, &core.OutputMessage{Data: 1}))
+	a.NoError(router.SendOutputs(ctx, []*core.OutputMessage{{Data: "a"}, {Data: 2}, {Data: "b"}}))
+	a.Equal([]interface{}{1, 2}, numbers.Values())
+	a.Equal([]interface{}{"a", "b"}, others.Values())
+	a.NoError(router.Close(ctx))
+
+	a.ErrorIs(NewRouter().SendOutput(ctx, &core.OutputMessage{Data: 1}), ErrNoRoute)
+}
+
+// sliceOutput cannot be compared with ==, the router must not use it as a map key.
+type sliceOutput []*memory.Output
+
+func (o sliceOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	return o[0].SendOutput(ctx, message)
+}
+
+func (o sliceOutput) OnDone(cxt context.Context, message *core.OutputMessage) {}
+
+func (o sliceOutput) OnError(cxt context.Context, message *core.OutputMessage, err error) {}
+
+func (o sliceOutput) Close(ctx context.Context) error {
+	return o[0].Close(ctx)
+}
+
+func TestRouterNotComparableOutput(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	shared := memory.NewOutput()
+	others := sliceOutput{memory.NewOutput()}
+	router := NewRouter(
+		Route{Match: func(ctx context.Context, message *core.OutputMessage) bool {
+			return message.Data == 1
+		}, Output: shared},
+		Route{Match: func(ctx context.Context, message *core.OutputMessage) bool {
+			return message.Data == 2
+		}, Output: shared},
+		Route{Output: others},
+	)
+	a.NoError(router.SendOutputs(ctx, []*core.OutputMessage{{Data: "a"}, {Data: 2}, {Data: 1}}))
+	a.Equal([]interface{}{2, 1}, shared.Values())
+	a.Equal([]interface{}{"a"}, others[0].Values())
+	a.Len(router.outputs, 2)
+	a.NoError(router.Close(ctx))
+}
+
+// partialOutput fails the messages whose Data is "bad" with a core.PartialError.
+type partialOutput struct {
+	*memory.Output
+}
+
+func (o partialOutput) SendOutputs(ctx context.Context, messages []*core.OutputMessage) error {
+	var failed []*core.OutputMessage
+	for _, message := range messages {
+		if message.Data == "bad" {
+			failed = append(failed, message)
+			continue
+		}
+		if err := o.Output.SendOutput(ctx, message); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return &core.PartialError{Failed: failed, Err: errors.New("bad")}
+	}
+	return nil
+}
+
+func TestRouterPartialFailure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	numbers, strs := memory.NewOutput(), partialOutput{memory.NewOutput()}
+	router := NewRouter(
+		Route{Match: func(ctx context.Context, message *core.OutputMessage) bool {
+			_, ok := message.Data.(int)
+			return ok
+		}, Output: numbers},
+		Route{Match: func(ctx context.Context, message *core.OutputMessage) bool {
+			_, ok := message.Data.(string)
+			return ok
+		}, Output: strs},
+	)
+	messages := []*core.OutputMessage{{Data: "a"}, {Data: 1.5}, {Data: "bad"}, {Data: 2}}
+	err := router.SendOutputs(ctx, messages)
+	var partialErr *core.PartialError
+	a.ErrorAs(err, &partialErr)
+	a.ErrorIs(err, ErrNoRoute)
+	a.ElementsMatch([]*core.OutputMessage{messages[1], messages[2]}, partialErr.Failed)
+	a.Equal([]interface{}{2}, numbers.Values(), "the groups after a failure are sent")
+	a.Equal([]interface{}{"a"}, strs.Values())
+
+	a.ErrorIs(router.SendOutputs(ctx, []*core.OutputMessage{{Data: 1.5}}), ErrNoRoute)
+}
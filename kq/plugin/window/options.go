@@ -0,0 +1,46 @@
+package window
+
+import (
+	"context"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+type options struct {
+	keyFunc         func(message core.Message) string
+	allowedLateness time.Duration
+	idleTimeout     time.Duration
+	onLate          func(ctx context.Context, message core.Message)
+}
+
+type Option func(*options)
+
+// WithKeyFunc sets the key windows are kept by, every message shares the empty key by default
+func WithKeyFunc(keyFunc func(message core.Message) string) Option {
+	return func(o *options) {
+		o.keyFunc = keyFunc
+	}
+}
+
+// WithAllowedLateness keeps windows open for lateness after the watermark passed their end
+func WithAllowedLateness(lateness time.Duration) Option {
+	return func(o *options) {
+		o.allowedLateness = lateness
+	}
+}
+
+// WithIdleTimeout advances the watermark by the wall clock when no message arrived for timeout,
+// so windows close on quiet streams, disabled by default
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = timeout
+	}
+}
+
+// WithOnLate is called for messages arriving after all their windows closed, they are acked and dropped
+func WithOnLate(onLate func(ctx context.Context, message core.Message)) Option {
+	return func(o *options) {
+		o.onLate = onLate
+	}
+}
@@ -0,0 +1,382 @@
+// Package window aggregates messages over event-time windows.
+//
+// The windows hold the messages they aggregate: their offsets are committed only once the
+// aggregates listing them have been delivered, so long windows delay the commits of a partition.
+package window
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+var _ core.Aggregator = (*windows[int])(nil)
+
+// ErrInvalidWindow is returned by New when the assigner or the aggregation cannot make windows.
+var ErrInvalidWindow = errors.New("window: invalid window")
+
+// Assigner decides the windows of a message, see Tumbling, Sliding and Session.
+type Assigner struct {
+	size    time.Duration
+	slide   time.Duration
+	gap     time.Duration
+	session bool
+}
+
+// Tumbling windows last size and follow each other without overlapping, size must be positive.
+func Tumbling(size time.Duration) Assigner {
+	return Assigner{size: size, slide: size}
+}
+
+// Sliding windows last size and a new one starts every slide, a message belongs to size/slide windows.
+// slide must be positive and at most size, larger slides would leave gaps between the windows.
+func Sliding(size, slide time.Duration) Assigner {
+	return Assigner{size: size, slide: slide}
+}
+
+// Session windows group the messages of a key until no message arrived for gap, gap must be positive.
+func Session(gap time.Duration) Assigner {
+	return Assigner{gap: gap, session: true}
+}
+
+func (a Assigner) validate() error {
+	if a.session {
+		if a.gap <= 0 {
+			return fmt.Errorf("%w: session gap %v is not positive", ErrInvalidWindow, a.gap)
+		}
+		return nil
+	}
+	if a.size <= 0 {
+		return fmt.Errorf("%w: size %v is not positive", ErrInvalidWindow, a.size)
+	}
+	if a.slide <= 0 || a.slide > a.size {
+		return fmt.Errorf("%w: slide %v is not within (0, %v]", ErrInvalidWindow, a.slide, a.size)
+	}
+	return nil
+}
+
+type span struct {
+	start, end time.Time
+}
+
+// spans returns the tumbling or sliding windows containing t.
+func (a Assigner) spans(t time.Time) []span {
+	var spans []span
+	for start := t.Truncate(a.slide); start.Add(a.size).After(t); start = start.Add(-a.slide) {
+		spans = append(spans, span{start: start, end: start.Add(a.size)})
+	}
+	return spans
+}
+
+// Aggregation folds the messages of a window into an accumulator of type A.
+type Aggregation[A any] struct {
+	Init func() A
+	Add  func(acc A, message core.Message) A
+	// Merge combines two accumulators, it is only needed by session windows.
+	Merge func(a, b A) A
+}
+
+// Result is the Data of the output message emitted when a window closes.
+type Result[A any] struct {
+	Key   string    `json:"key"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+	Value A         `json:"value"`
+}
+
+// resultMessage describes an aggregate to the middlewares of the output stage,
+// its ID is stable for a key and a window.
+type resultMessage struct {
+	id  string
+	end time.Time
+}
+
+func (m *resultMessage) ID() string {
+	return m.id
+}
+
+func (m *resultMessage) Timestamp() time.Time {
+	return m.end
+}
+
+func (m *resultMessage) Ctx() context.Context {
+	return context.Background()
+}
+
+type window[A any] struct {
+	key        string
+	start, end time.Time
+	count      int
+	value      A
+	inputs     []core.Message
+}
+
+type windows[A any] struct {
+	options
+	assigner    Assigner
+	aggregation Aggregation[A]
+
+	mu        sync.Mutex
+	emit      core.Emit
+	watermark time.Time
+	arrived   bool
+	open      map[string][]*window[A]
+	// nextEnd is at most the earliest end of the open windows, zero when there is none.
+	nextEnd time.Time
+}
+
+// New returns a core.Aggregator folding messages into windows with aggregation and emitting a Result
+// once the watermark, the latest message timestamp seen, passes the end of a window plus the allowed
+// lateness. Messages without a timestamp use the processing time. It returns ErrInvalidWindow when
+// the assigner durations are invalid or session windows are used without Aggregation.Merge.
+func New[A any](assigner Assigner, aggregation Aggregation[A], opts ...Option) (core.Aggregator, error) {
+	if err := assigner.validate(); err != nil {
+		return nil, err
+	}
+	if assigner.session && aggregation.Merge == nil {
+		return nil, fmt.Errorf("%w: session windows need Aggregation.Merge", ErrInvalidWindow)
+	}
+	w := &windows[A]{
+		assigner:    assigner,
+		aggregation: aggregation,
+		open:        make(map[string][]*window[A]),
+	}
+	for _, opt := range opts {
+		opt(&w.options)
+	}
+	return w, nil
+}
+
+func (w *windows[A]) Open(ctx context.Context, emit core.Emit) {
+	w.mu.Lock()
+	w.emit = emit
+	w.mu.Unlock()
+	if w.idleTimeout > 0 {
+		go w.advanceIdle(ctx)
+	}
+}
+
+// advanceIdle moves the watermark forward by the wall clock while no message arrives.
+func (w *windows[A]) advanceIdle(ctx context.Context) {
+	ticker := time.NewTicker(w.idleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		if !w.arrived && !w.watermark.IsZero() {
+			w.watermark = w.watermark.Add(w.idleTimeout)
+		}
+		w.arrived = false
+		closed, emit := w.collect(false), w.emit
+		w.mu.Unlock()
+		w.send(closed, emit)
+	}
+}
+
+func (w *windows[A]) Process(ctx context.Context, message core.Message) (*core.OutputMessage, error) {
+	t := message.Timestamp()
+	if t.IsZero() {
+		t = time.Now()
+	}
+	var key string
+	if w.keyFunc != nil {
+		key = w.keyFunc(message)
+	}
+	w.mu.Lock()
+	w.arrived = true
+	if t.After(w.watermark) {
+		w.watermark = t
+	}
+	var held int
+	var late bool
+	if w.assigner.session {
+		held, late = w.addSession(key, t, message)
+	} else {
+		held, late = w.addSpans(key, t, message)
+	}
+	closed, emit := w.collect(false), w.emit
+	w.mu.Unlock()
+	w.send(closed, emit)
+	if held == 0 {
+		if late && w.onLate != nil {
+			w.onLate(ctx, message)
+		}
+		return nil, nil
+	}
+	return core.Hold(held), nil
+}
+
+func (w *windows[A]) closed(end time.Time) bool {
+	return !w.watermark.Before(end.Add(w.allowedLateness))
+}
+
+// addSpans adds the message to its open tumbling or sliding windows. The lock must be held.
+func (w *windows[A]) addSpans(key string, t time.Time, message core.Message) (int, bool) {
+	spans := w.assigner.spans(t)
+	held := 0
+	for _, s := range spans {
+		if w.closed(s.end) {
+			continue
+		}
+		var win *window[A]
+		for _, open := range w.open[key] {
+			if open.start.Equal(s.start) {
+				win = open
+				break
+			}
+		}
+		if win == nil {
+			win = w.newWindow(key, s.start, s.end)
+			w.open[key] = append(w.open[key], win)
+		}
+		win.count++
+		win.value = w.aggregation.Add(win.value, message)
+		win.inputs = append(win.inputs, message)
+		held++
+	}
+	return held, len(spans) > 0 && held == 0
+}
+
+// addSession adds the message to a new session merged with the sessions it overlaps. The lock must be held.
+func (w *windows[A]) addSession(key string, t time.Time, message core.Message) (int, bool) {
+	session := w.newWindow(key, t, t.Add(w.assigner.gap))
+	session.count = 1
+	session.value = w.aggregation.Add(session.value, message)
+	session.inputs = []core.Message{message}
+	merged := false
+	var rest []*window[A]
+	for _, open := range w.open[key] {
+		if !open.start.Before(t.Add(w.assigner.gap)) || !t.Before(open.end) {
+			rest = append(rest, open)
+			continue
+		}
+		merged = true
+		if open.start.Before(session.start) {
+			session.start = open.start
+		}
+		if open.end.After(session.end) {
+			session.end = open.end
+		}
+		session.count += open.count
+		session.value = w.aggregation.Merge(open.value, session.value)
+		session.inputs = append(open.inputs, session.inputs...)
+	}
+	if !merged && w.closed(session.end) {
+		return 0, true
+	}
+	w.open[key] = append(rest, session)
+	return 1, false
+}
+
+func (w *windows[A]) newWindow(key string, start, end time.Time) *window[A] {
+	var value A
+	if w.aggregation.Init != nil {
+		value = w.aggregation.Init()
+	}
+	if w.nextEnd.IsZero() || end.Before(w.nextEnd) {
+		w.nextEnd = end
+	}
+	return &window[A]{key: key, start: start, end: end, value: value}
+}
+
+// collect removes the closed windows, or all of them, ordered by end. The lock must be held.
+func (w *windows[A]) collect(all bool) []*window[A] {
+	if !all && (w.nextEnd.IsZero() || !w.closed(w.nextEnd)) {
+		return nil
+	}
+	var closed []*window[A]
+	w.nextEnd = time.Time{}
+	for key, open := range w.open {
+		var rest []*window[A]
+		for _, win := range open {
+			if all || w.closed(win.end) {
+				closed = append(closed, win)
+				continue
+			}
+			rest = append(rest, win)
+			if w.nextEnd.IsZero() || win.end.Before(w.nextEnd) {
+				w.nextEnd = win.end
+			}
+		}
+		if len(rest) == 0 {
+			delete(w.open, key)
+		} else {
+			w.open[key] = rest
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if !closed[i].end.Equal(closed[j].end) {
+			return closed[i].end.Before(closed[j].end)
+		}
+		return closed[i].key < closed[j].key
+	})
+	return closed
+}
+
+func (w *windows[A]) send(closed []*window[A], emit core.Emit) {
+	for _, win := range closed {
+		emit(&core.Aggregate{
+			Message: &resultMessage{
+				id:  win.key + "@" + strconv.FormatInt(win.start.UnixNano(), 10),
+				end: win.end,
+			},
+			Output: &core.OutputMessage{
+				Ctx: context.Background(),
+				Data: Result[A]{
+					Key:   win.key,
+					Start: win.start,
+					End:   win.end,
+					Count: win.count,
+					Value: win.value,
+				},
+			},
+			Inputs: win.inputs,
+		})
+	}
+}
+
+func (w *windows[A]) Flush(ctx context.Context) {
+	w.mu.Lock()
+	closed, emit := w.collect(true), w.emit
+	w.mu.Unlock()
+	w.send(closed, emit)
+}
+
+func (w *windows[A]) OnDone(ctx context.Context, message core.Message) {}
+
+func (w *windows[A]) OnError(ctx context.Context, message core.Message, err error) {}
+
+// Count counts the messages of a window, like Result.Count.
+func Count() Aggregation[int] {
+	return Aggregation[int]{
+		Add: func(acc int, message core.Message) int {
+			return acc + 1
+		},
+		Merge: func(a, b int) int {
+			return a + b
+		},
+	}
+}
+
+// Sum adds up value over the messages of a window.
+func Sum(value func(message core.Message) float64) Aggregation[float64] {
+	return Aggregation[float64]{
+		Add: func(acc float64, message core.Message) float64 {
+			return acc + value(message)
+		},
+		Merge: func(a, b float64) float64 {
+			return a + b
+		},
+	}
+}
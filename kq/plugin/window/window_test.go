@@ -0,0 +1,238 @@
+package window
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq"
+	"github.com/colinrs/pkgx/kq/core"
+	kqjson "github.com/colinrs/pkgx/kq/plugin/extractor/json"
+	inmemory "github.com/colinrs/pkgx/kq/plugin/input/memory"
+	outmemory "github.com/colinrs/pkgx/kq/plugin/output/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMessage struct {
+	key   string
+	at    time.Time
+	value float64
+}
+
+func (m *testMessage) ID() string           { return m.key + "@" + m.at.String() }
+func (m *testMessage) Timestamp() time.Time { return m.at }
+func (m *testMessage) Ctx() context.Context { return context.Background() }
+
+func at(seconds int) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+type emitted struct {
+	mu         sync.Mutex
+	aggregates []*core.Aggregate
+}
+
+func (e *emitted) emit(aggregate *core.Aggregate) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.aggregates = append(e.aggregates, aggregate)
+}
+
+func (e *emitted) results() []Result[float64] {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	results := make([]Result[float64], 0, len(e.aggregates))
+	for _, aggregate := range e.aggregates {
+		results = append(results, aggregate.Output.Data.(Result[float64]))
+	}
+	return results
+}
+
+func newTestWindows(t *testing.T, assigner Assigner, opts ...Option) (core.Aggregator, *emitted) {
+	e := &emitted{}
+	opts = append([]Option{WithKeyFunc(func(message core.Message) string {
+		return message.(*testMessage).key
+	})}, opts...)
+	w, err := New(assigner, Sum(func(message core.Message) float64 {
+		return message.(*testMessage).value
+	}), opts...)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	w.Open(ctx, e.emit)
+	return w, e
+}
+
+func process(t *testing.T, w core.Aggregator, messages ...*testMessage) []int {
+	held := make([]int, 0, len(messages))
+	for _, message := range messages {
+		output, err := w.Process(context.Background(), message)
+		assert.NoError(t, err)
+		if output == nil {
+			held = append(held, 0)
+			continue
+		}
+		held = append(held, output.Held())
+	}
+	return held
+}
+
+func TestTumbling(t *testing.T) {
+	a := assert.New(t)
+	w, e := newTestWindows(t, Tumbling(time.Minute))
+	held := process(t, w,
+		&testMessage{key: "a", at: at(0), value: 1},
+		&testMessage{key: "a", at: at(30), value: 2},
+		&testMessage{key: "b", at: at(59), value: 3},
+		&testMessage{key: "a", at: at(61), value: 4})
+	a.Equal([]int{1, 1, 1, 1}, held)
+	a.Equal([]Result[float64]{
+		{Key: "a", Start: at(0), End: at(60), Count: 2, Value: 3},
+		{Key: "b", Start: at(0), End: at(60), Count: 1, Value: 3},
+	}, e.results())
+	a.Len(e.aggregates[0].Inputs, 2)
+	a.Equal("a@0", e.aggregates[0].Message.ID())
+
+	w.Flush(context.Background())
+	a.Len(e.results(), 3)
+	a.Equal(Result[float64]{Key: "a", Start: at(60), End: at(120), Count: 1, Value: 4}, e.results()[2])
+}
+
+func TestSliding(t *testing.T) {
+	a := assert.New(t)
+	w, e := newTestWindows(t, Sliding(time.Minute, 30*time.Second))
+	held := process(t, w,
+		&testMessage{key: "a", at: at(10), value: 1},
+		&testMessage{key: "a", at: at(40), value: 2},
+		&testMessage{key: "a", at: at(95), value: 4})
+	a.Equal([]int{2, 2, 2}, held)
+	a.Equal([]Result[float64]{
+		{Key: "a", Start: at(-30), End: at(30), Count: 1, Value: 1},
+		{Key: "a", Start: at(0), End: at(60), Count: 2, Value: 3},
+		{Key: "a", Start: at(30), End: at(90), Count: 1, Value: 2},
+	}, e.results())
+}
+
+func TestSession(t *testing.T) {
+	a := assert.New(t)
+	w, e := newTestWindows(t, Session(10*time.Second), WithAllowedLateness(10*time.Second))
+	held := process(t, w,
+		&testMessage{key: "a", at: at(0), value: 1},
+		&testMessage{key: "a", at: at(16), value: 2},
+		&testMessage{key: "a", at: at(8), value: 4},
+		&testMessage{key: "a", at: at(40), value: 8})
+	a.Equal([]int{1, 1, 1, 1}, held)
+	a.Equal([]Result[float64]{
+		{Key: "a", Start: at(0), End: at(26), Count: 3, Value: 7},
+	}, e.results())
+	a.Len(e.aggregates[0].Inputs, 3)
+}
+
+func TestInvalidWindow(t *testing.T) {
+	a := assert.New(t)
+	for name, assigner := range map[string]Assigner{
+		"zero":             {},
+		"zero tumbling":    Tumbling(0),
+		"negative size":    Sliding(-time.Minute, time.Second),
+		"zero slide":       Sliding(time.Minute, 0),
+		"slide above size": Sliding(time.Minute, 2*time.Minute),
+		"zero session":     Session(0),
+	} {
+		_, err := New(assigner, Count())
+		a.ErrorIs(err, ErrInvalidWindow, name)
+	}
+	_, err := New(Session(time.Second), Aggregation[int]{Add: Count().Add})
+	a.ErrorIs(err, ErrInvalidWindow)
+	_, err = New(Sliding(time.Minute, time.Minute), Count())
+	a.NoError(err)
+}
+
+func TestAllowedLateness(t *testing.T) {
+	a := assert.New(t)
+	var late []core.Message
+	w, e := newTestWindows(t, Tumbling(time.Minute), WithAllowedLateness(10*time.Second),
+		WithOnLate(func(ctx context.Context, message core.Message) {
+			late = append(late, message)
+		}))
+	tooLate := &testMessage{key: "a", at: at(5), value: 8}
+	held := process(t, w,
+		&testMessage{key: "a", at: at(0), value: 1},
+		&testMessage{key: "a", at: at(65), value: 2},
+		&testMessage{key: "a", at: at(50), value: 4},
+		&testMessage{key: "a", at: at(70), value: 0},
+		tooLate)
+	a.Equal([]int{1, 1, 1, 1, 0}, held)
+	a.Equal([]Result[float64]{
+		{Key: "a", Start: at(0), End: at(60), Count: 2, Value: 5},
+	}, e.results())
+	a.Equal([]core.Message{tooLate}, late)
+}
+
+func TestIdleTimeout(t *testing.T) {
+	w, e := newTestWindows(t, Tumbling(20*time.Millisecond), WithIdleTimeout(10*time.Millisecond))
+	process(t, w, &testMessage{key: "a", at: at(0), value: 1})
+	assert.Eventually(t, func() bool {
+		return len(e.results()) == 1
+	}, time.Second, time.Millisecond)
+}
+
+type event struct {
+	User  string  `json:"user"`
+	At    int64   `json:"at"`
+	Value float64 `json:"value"`
+}
+
+func TestWindowPipeline(t *testing.T) {
+	// messages must reach the window in order for the first windows to close before the last message
+	for name, opt := range map[string]kq.Option{
+		"unordered":   kq.WithMaxGoroutines(1),
+		"key-ordered": kq.WithKeyOrdered(1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testWindowPipeline(t, opt)
+		})
+	}
+}
+
+func testWindowPipeline(t *testing.T, opt kq.Option) {
+	a := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var values [][]byte
+	for _, e := range []event{{"a", 0, 1}, {"b", 10, 2}, {"a", 30, 4}, {"a", 65, 8}} {
+		values = append(values, []byte(`{"user":"`+e.User+`","at":`+strconv.FormatInt(e.At, 10)+
+			`,"value":`+strconv.FormatFloat(e.Value, 'f', -1, 64)+`}`))
+	}
+	input := inmemory.NewInputFromSlice(inmemory.Messages("events", values...))
+	output := outmemory.NewOutput()
+	aggregator, err := New(Tumbling(time.Minute), Sum(func(message core.Message) float64 {
+		e, _ := kqjson.Value[event](message)
+		return e.Value
+	}), WithKeyFunc(func(message core.Message) string {
+		e, _ := kqjson.Value[event](message)
+		return e.User
+	}))
+	a.NoError(err)
+	k := kq.NewKQ(ctx, opt).
+		SetInput(ctx, input).
+		SetExtractor(ctx, kqjson.NewExtractor[event](ctx, kqjson.WithTimestampField("at"))).
+		SetTransformer(ctx, aggregator).
+		SetOutput(ctx, output)
+	a.NoError(k.Run(ctx))
+	a.NoError(output.Wait(ctx, 2))
+	a.Eventually(func() bool {
+		return input.Committed()["events"][0] == 2
+	}, time.Second, time.Millisecond, "the last message is held by the open window")
+	a.Equal(uint64(3), k.Stats().Completed)
+
+	a.NoError(k.Close(ctx))
+	a.Equal([]interface{}{
+		Result[float64]{Key: "a", Start: at(0), End: at(60), Count: 2, Value: 5},
+		Result[float64]{Key: "b", Start: at(0), End: at(60), Count: 1, Value: 2},
+		Result[float64]{Key: "a", Start: at(60), End: at(120), Count: 1, Value: 8},
+	}, output.Values())
+	a.Equal(int64(3), input.Committed()["events"][0])
+}
@@ -0,0 +1,88 @@
+package kq
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how often and how fast a failed stage call is retried.
+type RetryPolicy struct {
+	// MaxAttempts includes the first call, values below 2 disable retries.
+	MaxAttempts int `yaml:"max_attempts" json:"max_attempts"`
+	// InitialBackoff is the wait before the second attempt.
+	InitialBackoff time.Duration `yaml:"initial_backoff" json:"initial_backoff"`
+	// MaxBackoff caps the wait between two attempts, 0 means no cap.
+	MaxBackoff time.Duration `yaml:"max_backoff" json:"max_backoff"`
+	// Multiplier grows the backoff after every attempt, values below 1 are treated as 2.
+	Multiplier float64 `yaml:"multiplier" json:"multiplier"`
+	// Jitter randomizes every backoff by up to the given fraction, between 0 and 1.
+	Jitter float64 `yaml:"jitter" json:"jitter"`
+	// Retryable reports whether err is transient, nil retries every error.
+	Retryable func(err error) bool `yaml:"-" json:"-"`
+}
+
+func (p *RetryPolicy) shouldRetry(attempts int, err error) bool {
+	if p == nil || attempts >= p.MaxAttempts {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempts; i++ {
+		backoff *= multiplier
+		if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+			backoff = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff += backoff * jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	return time.Duration(backoff)
+}
+
+// retry calls fn until it succeeds or the policy gives up and returns the attempts made.
+// The goroutine slot held by the caller is given back while waiting for the next attempt.
+func (k *KQ) retry(ctx context.Context, policy *RetryPolicy, fn func() error) (int, error) {
+	return retry(ctx, policy, fn, k.limitGoroutines.Release, k.limitGoroutines.Acquire)
+}
+
+// retry calls fn until it succeeds or the policy gives up, release and acquire are called
+// around every wait for the next attempt.
+func retry(ctx context.Context, policy *RetryPolicy, fn func() error, release, acquire func()) (int, error) {
+	attempts := 0
+	for {
+		attempts++
+		err := fn()
+		if err == nil || !policy.shouldRetry(attempts, err) {
+			return attempts, err
+		}
+		timer := time.NewTimer(policy.backoff(attempts))
+		release()
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			acquire()
+			return attempts, err
+		case <-timer.C:
+		}
+		acquire()
+	}
+}
+
+func noop() {}
@@ -0,0 +1,88 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/plugin/deadletter/memory"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	a := assert.New(t)
+	policy := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Multiplier:     2,
+	}
+	a.Equal(10*time.Millisecond, policy.backoff(1))
+	a.Equal(20*time.Millisecond, policy.backoff(2))
+	a.Equal(40*time.Millisecond, policy.backoff(3))
+	a.Equal(50*time.Millisecond, policy.backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := policy.backoff(2)
+		a.True(backoff >= 10*time.Millisecond && backoff <= 30*time.Millisecond, backoff)
+	}
+
+	a.True(policy.shouldRetry(4, errors.New("x")))
+	a.False(policy.shouldRetry(5, errors.New("x")))
+	var nilPolicy *RetryPolicy
+	a.False(nilPolicy.shouldRetry(1, errors.New("x")))
+}
+
+type flakyOutput struct {
+	testOutput
+	mu       sync.Mutex
+	failures map[interface{}]int
+	err      error
+}
+
+func (o *flakyOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	o.mu.Lock()
+	if o.failures[message.Data] > 0 {
+		o.failures[message.Data]--
+		o.mu.Unlock()
+		return o.err
+	}
+	o.mu.Unlock()
+	return o.testOutput.SendOutput(ctx, message)
+}
+
+var errTransient = errors.New("transient")
+
+func TestKQOutputRetry(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	output := &flakyOutput{failures: map[interface{}]int{"0": 2, "1": 5}, err: errTransient}
+	deadLetter := memory.NewDeadLetter()
+	k := newTestKQ(ctx, newTestInput(1, 3), &testTransformer{}, output,
+		WithMaxGoroutines(1),
+		WithOutputRetryPolicy(RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Retryable: func(err error) bool {
+				return errors.Is(err, errTransient)
+			},
+		})).
+		SetDeadLetter(ctx, deadLetter)
+	a.NoError(k.Run(ctx))
+	for output.count()+len(deadLetter.Messages()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	a.ElementsMatch([]interface{}{"0", "2"}, output.received)
+	deadLetters := deadLetter.Messages()
+	a.Len(deadLetters, 1)
+	a.Equal(core.StageOutput, deadLetters[0].Stage)
+	a.Equal(3, deadLetters[0].Attempts)
+	a.Equal("1", string(deadLetters[0].Raw.Value))
+}
@@ -0,0 +1,245 @@
+package kq
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/metrics"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultMetricsInterval = 10 * time.Second
+
+	batchStageName = "batch"
+
+	recentLatencyWeight = 5
+
+	metricConsumed         = "kq_messages_consumed_total"
+	metricCompleted        = "kq_messages_completed_total"
+	metricStageErrors      = "kq_stage_errors_total"
+	metricStageDuration    = "kq_stage_duration_seconds"
+	metricChannelLength    = "kq_channel_length"
+	metricChannelCapacity  = "kq_channel_capacity"
+	metricGoroutinesInUse  = "kq_goroutines_in_use"
+	metricGoroutinesMax    = "kq_goroutines_max"
+	metricInFlight         = "kq_in_flight_messages"
+	metricPartitionLag     = "kq_partition_lag"
+	metricPartitionPending = "kq_partition_in_flight_messages"
+	metricPaused           = "kq_input_paused"
+	metricInputErrors      = "kq_input_errors_total"
+)
+
+var (
+	stageNames = []string{core.StageExtractor, core.StageTransformer, core.StageOutput, batchStageName}
+)
+
+// Stats is a snapshot of the pipeline state.
+type Stats struct {
+	Status     string
+	Paused     bool
+	Input      InputHealth
+	Consumed   uint64
+	Completed  uint64
+	InFlight   int
+	Goroutines GoroutineStats
+	Channels   []ChannelStats
+	Stages     []StageStats
+	Partitions []PartitionStats
+}
+
+type GoroutineStats struct {
+	InUse int
+	Max   int
+}
+
+type ChannelStats struct {
+	Name string
+	Len  int
+	Cap  int
+}
+
+type StageStats struct {
+	Stage      string
+	Processed  uint64
+	Errors     uint64
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+}
+
+// PartitionStats describes the offsets of a topic-partition, offsets are -1 until known.
+// Lag counts the messages after the committed offset, or from the first consumed offset before
+// the first commit, up to the high water mark when the input reports it and up to the last
+// consumed offset otherwise.
+type PartitionStats struct {
+	Topic         string
+	Partition     int32
+	InFlight      int
+	Consumed      int64
+	Committed     int64
+	HighWaterMark int64
+	Lag           int64
+}
+
+type stageStats struct {
+	processed    atomic.Uint64
+	errors       atomic.Uint64
+	totalLatency atomic.Int64
+	maxLatency   atomic.Int64
+	// recentLatency is an exponentially weighted moving average used by backpressure.
+	recentLatency atomic.Int64
+	labels        metrics.Labels
+}
+
+func newStageStats() map[string]*stageStats {
+	stats := make(map[string]*stageStats, len(stageNames))
+	for _, stage := range stageNames {
+		stats[stage] = &stageStats{labels: metrics.Labels{"stage": stage}}
+	}
+	return stats
+}
+
+func (s *stageStats) observe(duration time.Duration, err error) {
+	s.processed.Inc()
+	if err != nil {
+		s.errors.Inc()
+	}
+	s.totalLatency.Add(int64(duration))
+	for {
+		recent := s.recentLatency.Load()
+		if s.recentLatency.CompareAndSwap(recent, recent+(int64(duration)-recent)/recentLatencyWeight) {
+			break
+		}
+	}
+	for {
+		max := s.maxLatency.Load()
+		if int64(duration) <= max || s.maxLatency.CompareAndSwap(max, int64(duration)) {
+			return
+		}
+	}
+}
+
+func (k *KQ) observeStage(stage string, duration time.Duration, err error) {
+	s, ok := k.stageStats[stage]
+	if !ok {
+		return
+	}
+	s.observe(duration, err)
+	if k.metricsSink == nil {
+		return
+	}
+	k.metricsSink.ObserveHistogram(metricStageDuration, s.labels, duration.Seconds())
+	if err != nil {
+		k.metricsSink.AddCounter(metricStageErrors, s.labels, 1)
+	}
+}
+
+func (k *KQ) incConsumed() {
+	k.consumed.Inc()
+	if k.metricsSink != nil {
+		k.metricsSink.AddCounter(metricConsumed, nil, 1)
+	}
+}
+
+func (k *KQ) incCompleted() {
+	k.completed.Inc()
+	if k.metricsSink != nil {
+		k.metricsSink.AddCounter(metricCompleted, nil, 1)
+	}
+}
+
+// Stats returns a snapshot of the channels, goroutines, stages and partitions of the pipeline.
+func (k *KQ) Stats() Stats {
+	stats := Stats{
+		Status:    statusName(k.kqStatus.Load()),
+		Paused:    k.Paused(),
+		Input:     k.inputHealth.load(),
+		Consumed:  k.consumed.Load(),
+		Completed: k.completed.Load(),
+		InFlight:  k.offsetTracker.pending(),
+		Goroutines: GoroutineStats{
+			InUse: k.maxGoroutines - k.limitGoroutines.AvailablePermits(),
+			Max:   k.maxGoroutines,
+		},
+		Channels: []ChannelStats{
+			{Name: "input", Len: len(k.inputMessageChannel), Cap: cap(k.inputMessageChannel)},
+			{Name: "extractor", Len: len(k.extractorMessageChan), Cap: cap(k.extractorMessageChan)},
+			{Name: "output", Len: len(k.outPutMessageChanel), Cap: cap(k.outPutMessageChanel)},
+		},
+	}
+	var highWaterMarks map[string]map[int32]int64
+	if marker, ok := k.input.(core.HighWaterMarker); ok {
+		highWaterMarks = marker.HighWaterMarks()
+	}
+	stats.Partitions = k.offsetTracker.partitionStats(highWaterMarks)
+	if k.batchChannel != nil {
+		stats.Channels = append(stats.Channels,
+			ChannelStats{Name: "batch", Len: len(k.batchChannel), Cap: cap(k.batchChannel)})
+	}
+	for _, stage := range stageNames {
+		s := k.stageStats[stage]
+		stageStat := StageStats{
+			Stage:      stage,
+			Processed:  s.processed.Load(),
+			Errors:     s.errors.Load(),
+			MaxLatency: time.Duration(s.maxLatency.Load()),
+		}
+		if stageStat.Processed > 0 {
+			stageStat.AvgLatency = time.Duration(s.totalLatency.Load() / int64(stageStat.Processed))
+		}
+		stats.Stages = append(stats.Stages, stageStat)
+	}
+	return stats
+}
+
+// reportMetrics pushes the gauges of Stats to the metrics sink every metricsInterval.
+func (k *KQ) reportMetrics(ctx context.Context) error {
+	ticker := time.NewTicker(k.metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			k.pushGauges(k.Stats())
+		}
+	}
+}
+
+func (k *KQ) pushGauges(stats Stats) {
+	sink := k.metricsSink
+	for _, c := range stats.Channels {
+		labels := metrics.Labels{"channel": c.Name}
+		sink.SetGauge(metricChannelLength, labels, float64(c.Len))
+		sink.SetGauge(metricChannelCapacity, labels, float64(c.Cap))
+	}
+	sink.SetGauge(metricGoroutinesInUse, nil, float64(stats.Goroutines.InUse))
+	sink.SetGauge(metricGoroutinesMax, nil, float64(stats.Goroutines.Max))
+	sink.SetGauge(metricInFlight, nil, float64(stats.InFlight))
+	paused := 0.0
+	if stats.Paused {
+		paused = 1
+	}
+	sink.SetGauge(metricPaused, nil, paused)
+	for _, p := range stats.Partitions {
+		labels := metrics.Labels{"topic": p.Topic, "partition": strconv.FormatInt(int64(p.Partition), 10)}
+		sink.SetGauge(metricPartitionLag, labels, float64(p.Lag))
+		sink.SetGauge(metricPartitionPending, labels, float64(p.InFlight))
+	}
+}
+
+func statusName(status int32) string {
+	switch status {
+	case kqStatusInit:
+		return "init"
+	case kqStatusRunning:
+		return "running"
+	case kqStatusClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
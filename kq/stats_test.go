@@ -0,0 +1,56 @@
+package kq
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+	"github.com/colinrs/pkgx/kq/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKQStats(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	input := newTestInput(2, 20)
+	output := &testOutput{}
+	k := newTestKQ(ctx, input, &testTransformer{}, output,
+		WithMaxGoroutines(8), WithMetrics(registry, time.Millisecond))
+	a.Equal("init", k.Stats().Status)
+	a.NoError(k.Run(ctx))
+	for k.Stats().Completed < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	stats := k.Stats()
+	a.Equal("running", stats.Status)
+	a.Equal(uint64(20), stats.Consumed)
+	a.Equal(8, stats.Goroutines.Max)
+	a.Len(stats.Channels, 3)
+	a.Len(stats.Partitions, 2)
+	for _, p := range stats.Partitions {
+		a.Equal(int64(9), p.Consumed)
+		a.Equal(int64(9), p.Committed)
+		a.Equal(int64(0), p.Lag)
+	}
+	for _, s := range stats.Stages {
+		if s.Stage == core.StageTransformer {
+			a.Equal(uint64(20), s.Processed)
+			a.Equal(uint64(0), s.Errors)
+		}
+	}
+	a.NoError(k.Close(ctx))
+
+	buf := &bytes.Buffer{}
+	a.NoError(registry.WritePrometheus(buf))
+	text := buf.String()
+	a.True(strings.Contains(text, `kq_messages_completed_total 20`), text)
+	a.True(strings.Contains(text, `kq_stage_duration_seconds_count{stage="output"} 20`), text)
+	a.True(strings.Contains(text, `kq_partition_lag{partition="1",topic="test"} 0`), text)
+}
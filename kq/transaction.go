@@ -0,0 +1,255 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+)
+
+const (
+	defaultTransactionMaxMessages = 1000
+	defaultTransactionInterval    = 100 * time.Millisecond
+)
+
+var (
+	ErrNotTransactional = errors.New("kq: exactly-once needs a core.TransactionalOutput and a core.Rewinder input")
+
+	errLeftUnacked = errors.New("kq: a message of the transaction was left unacked")
+)
+
+// TransactionOptions decides when the transaction of the exactly-once mode is committed,
+// a transaction is committed as soon as one of the limits is reached.
+type TransactionOptions struct {
+	// MaxMessages is the maximum number of input messages in a transaction, 1000 by default.
+	MaxMessages int `yaml:"max_messages" json:"max_messages"`
+	// Interval is how long a transaction stays open, 100ms by default.
+	Interval time.Duration `yaml:"interval" json:"interval"`
+}
+
+// transaction lets the input loop consume while a transaction is open
+// and parks it in between, so every consumed message belongs to exactly one transaction.
+type transaction struct {
+	maxMessages int
+
+	mu       sync.Mutex
+	open     bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	opened   chan struct{}
+	parked   chan struct{}
+	messages int
+	err      error
+	full     chan struct{}
+	// onEnds are called with the outcome of the transaction once it is committed or aborted.
+	onEnds []func(ctx context.Context, err error)
+}
+
+func newTransaction(maxMessages int) *transaction {
+	return &transaction{
+		maxMessages: maxMessages,
+		opened:      make(chan struct{}),
+		full:        make(chan struct{}, 1),
+	}
+}
+
+// begin opens a transaction, the input loop consumes with its context until end.
+func (t *transaction) begin(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ctx, t.cancel = context.WithCancel(ctx)
+	t.open = true
+	t.messages = 0
+	t.err = nil
+	t.onEnds = nil
+	t.parked = make(chan struct{})
+	select {
+	case <-t.full:
+	default:
+	}
+	close(t.opened)
+}
+
+// end stops the consumption for the current transaction,
+// the returned channel is closed once the input loop is parked.
+func (t *transaction) end() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.open = false
+	t.cancel()
+	t.opened = make(chan struct{})
+	return t.parked
+}
+
+// wait is called by the input loop before every Consumer call, it returns the context of the open
+// transaction and parks the loop until the next one begins.
+func (t *transaction) wait(ctx context.Context) (context.Context, bool) {
+	for {
+		t.mu.Lock()
+		if t.open {
+			txnCtx := t.ctx
+			t.mu.Unlock()
+			return txnCtx, true
+		}
+		if t.parked != nil {
+			close(t.parked)
+			t.parked = nil
+		}
+		opened := t.opened
+		t.mu.Unlock()
+		select {
+		case <-opened:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// add counts a message consumed in the current transaction.
+func (t *transaction) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages++
+	if t.messages == t.maxMessages {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// fail marks the current transaction to be aborted.
+func (t *transaction) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *transaction) failed() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// onEnd registers fn to be called once the current transaction is committed or aborted.
+func (t *transaction) onEnd(fn func(ctx context.Context, err error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.onEnds = append(t.onEnds, fn)
+}
+
+// ended calls the functions registered with onEnd.
+func (t *transaction) ended(ctx context.Context, err error) {
+	t.mu.Lock()
+	onEnds := t.onEnds
+	t.onEnds = nil
+	t.mu.Unlock()
+	for _, fn := range onEnds {
+		fn(ctx, err)
+	}
+}
+
+// transactionMessage runs the transactions of the exactly-once mode: it lets the input loop consume
+// for a while, waits until every consumed message has been acked and then commits their outputs
+// and offsets together, or aborts and rewinds the input when an output failed.
+func (k *KQ) transactionMessage(ctx, inputCtx context.Context) error {
+	output := k.output.(core.TransactionalOutput)
+	for {
+		if err := output.BeginTransaction(ctx); err != nil {
+			fmt.Printf("kq begin transaction. err=[%v]\n", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(k.transactionOptions.Interval):
+			}
+			continue
+		}
+		k.transaction.begin(inputCtx)
+		interval := time.NewTimer(k.transactionOptions.Interval)
+		select {
+		case <-interval.C:
+		case <-k.transaction.full:
+		case <-k.inputDone:
+		case <-ctx.Done():
+		}
+		interval.Stop()
+		k.endTransaction(ctx, output)
+		select {
+		case <-k.inputDone:
+			<-ctx.Done()
+			return ctx.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+	}
+}
+
+func (k *KQ) endTransaction(ctx context.Context, output core.TransactionalOutput) {
+	parked := k.transaction.end()
+	select {
+	case <-parked:
+	case <-k.inputDone:
+	}
+	commits, done, err := k.collectTransaction(ctx)
+	if err == nil {
+		err = k.transaction.failed()
+	}
+	// the transaction is finished even when ctx is done, e.g. by Close after the drain
+	endCtx := context.Background()
+	if err == nil {
+		err = output.CommitTransaction(endCtx, commits)
+	}
+	if err != nil {
+		fmt.Printf("kq abort transaction. err=[%v]\n", err)
+		if abortErr := output.AbortTransaction(endCtx); abortErr != nil {
+			fmt.Printf("kq abort transaction. err=[%v]\n", abortErr)
+		}
+		if rewindErr := k.input.(core.Rewinder).Rewind(endCtx); rewindErr != nil {
+			fmt.Printf("kq rewind input. err=[%v]\n", rewindErr)
+		}
+	}
+	k.transaction.ended(endCtx, err)
+	for _, m := range done {
+		m.Release()
+	}
+}
+
+// collectTransaction waits until every message of the transaction is acked,
+// it returns the last message of every partition and all the messages. A message left unacked
+// fails the transaction, the input is rewound so the tracked messages are all given up.
+func (k *KQ) collectTransaction(ctx context.Context) ([]*core.InputMessage, []*core.InputMessage, error) {
+	var (
+		last = make(map[topicPartition]*core.InputMessage)
+		all  []*core.InputMessage
+	)
+	for {
+		commits, done := k.offsetTracker.collect()
+		for _, m := range commits {
+			last[topicPartitionOf(m)] = m
+		}
+		all = append(all, done...)
+		if k.offsetTracker.pending() == 0 {
+			break
+		}
+		if k.offsetTracker.processing() == 0 && k.offsetTracker.failures() > 0 {
+			return nil, append(all, k.offsetTracker.clear()...), errLeftUnacked
+		}
+		select {
+		case <-k.offsetTracker.notify:
+		case <-ctx.Done():
+			// the messages still in flight are given up with the transaction
+			return nil, all, ctx.Err()
+		}
+	}
+	commits := make([]*core.InputMessage, 0, len(last))
+	for _, m := range last {
+		commits = append(commits, m)
+	}
+	return commits, all, nil
+}
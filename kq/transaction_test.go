@@ -0,0 +1,230 @@
+package kq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colinrs/pkgx/kq/core"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+// transactionalLog is a single partition topic whose offsets are committed by transactions.
+type transactionalLog struct {
+	mu       sync.Mutex
+	messages []*sarama.ConsumerMessage
+	position int64
+	// committed is the offset of the next message to consume once the group restarts
+	committed int64
+
+	failures map[interface{}]int
+	pending  []interface{}
+	produced []interface{}
+	aborts   int
+}
+
+func newTransactionalLog(count int) *transactionalLog {
+	l := &transactionalLog{failures: make(map[interface{}]int)}
+	for i := 0; i < count; i++ {
+		l.messages = append(l.messages, &sarama.ConsumerMessage{
+			Topic: "test", Offset: int64(i), Value: []byte(fmt.Sprintf("%d", i)),
+		})
+	}
+	return l
+}
+
+type transactionalInput struct {
+	*transactionalLog
+}
+
+func (in *transactionalInput) Consumer(ctx context.Context) (*core.InputMessage, error) {
+	in.mu.Lock()
+	if in.position < int64(len(in.messages)) {
+		m := core.NewInputMessage()
+		m.Raw = in.messages[in.position]
+		in.position++
+		in.mu.Unlock()
+		return m, nil
+	}
+	in.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (in *transactionalInput) CommitMessage(ctx context.Context, inputMessage *core.InputMessage) error {
+	panic("offsets are committed by the transactions")
+}
+
+func (in *transactionalInput) Rewind(ctx context.Context) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.position = in.committed
+	return nil
+}
+
+func (in *transactionalInput) Close(ctx context.Context) error {
+	return nil
+}
+
+type transactionalOutput struct {
+	*transactionalLog
+}
+
+func (o *transactionalOutput) SendOutput(ctx context.Context, message *core.OutputMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failures[message.Data] > 0 {
+		o.failures[message.Data]--
+		return errTransient
+	}
+	o.pending = append(o.pending, message.Data)
+	return nil
+}
+
+func (o *transactionalOutput) BeginTransaction(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = nil
+	return nil
+}
+
+func (o *transactionalOutput) CommitTransaction(ctx context.Context, inputs []*core.InputMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, input := range inputs {
+		o.committed = input.Raw.Offset + 1
+	}
+	o.produced = append(o.produced, o.pending...)
+	o.pending = nil
+	return nil
+}
+
+func (o *transactionalOutput) AbortTransaction(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = nil
+	o.aborts++
+	return nil
+}
+
+func (o *transactionalOutput) OnDone(ctx context.Context, message *core.OutputMessage) {}
+
+func (o *transactionalOutput) OnError(ctx context.Context, message *core.OutputMessage, err error) {}
+
+func (o *transactionalOutput) Close(ctx context.Context) error {
+	return nil
+}
+
+func (l *transactionalLog) state() (committed int64, produced []interface{}, aborts int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.committed, append([]interface{}(nil), l.produced...), l.aborts
+}
+
+func TestKQExactlyOnce(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	log := newTransactionalLog(50)
+	log.failures["7"] = 1
+	log.failures["31"] = 2
+	k := newTestKQ(ctx, &transactionalInput{log}, &testTransformer{}, &transactionalOutput{log},
+		WithExactlyOnce(TransactionOptions{MaxMessages: 10, Interval: 5 * time.Millisecond}))
+	a.NoError(k.Run(ctx))
+	for {
+		committed, _, _ := log.state()
+		if committed == 50 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	a.NoError(k.Close(ctx))
+
+	_, produced, aborts := log.state()
+	expected := make([]interface{}, 0, 50)
+	for i := 0; i < 50; i++ {
+		expected = append(expected, fmt.Sprintf("%d", i))
+	}
+	a.ElementsMatch(expected, produced)
+	a.GreaterOrEqual(aborts, 2)
+}
+
+func TestKQExactlyOnceSentOnEnd(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	log := newTransactionalLog(30)
+	log.failures["7"] = 1
+	var (
+		mu      sync.Mutex
+		early   []int
+		aborted int
+		sent    = make(map[int]bool)
+	)
+	onSent := func(next core.Handler) core.Handler {
+		return func(ctx context.Context, message *core.StageMessage) error {
+			if message.Stage == core.StageOutput {
+				id, _ := strconv.Atoi(message.Message.ID())
+				message.OnSent(func(ctx context.Context, err error) {
+					committed, _, _ := log.state()
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						aborted++
+						return
+					}
+					if int64(id) >= committed {
+						early = append(early, id)
+					}
+					sent[id] = true
+				})
+			}
+			return next(ctx, message)
+		}
+	}
+	k := newTestKQ(ctx, &transactionalInput{log}, &testTransformer{}, &transactionalOutput{log},
+		WithExactlyOnce(TransactionOptions{MaxMessages: 10, Interval: 5 * time.Millisecond})).
+		SetMiddleware(ctx, onSent)
+	a.NoError(k.Run(ctx))
+	a.Eventually(func() bool {
+		committed, _, _ := log.state()
+		return committed == 30
+	}, time.Second, time.Millisecond)
+	a.NoError(k.Close(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	a.Empty(early, "messages are reported sent once their transaction is committed")
+	a.Len(sent, 30)
+	a.Greater(aborted, 0, "the messages of the aborted transaction are reported failed")
+}
+
+func TestKQExactlyOnceDeadLetterFailure(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	log := newTransactionalLog(5)
+	deadLetter := &failingDeadLetter{failures: 1}
+	k := newTestKQ(ctx, &transactionalInput{log}, &failingTransformer{err: errors.New("process")},
+		&transactionalOutput{log}, WithExactlyOnce(TransactionOptions{Interval: 5 * time.Millisecond})).
+		SetDeadLetter(ctx, deadLetter)
+	a.NoError(k.Run(ctx))
+	a.Eventually(func() bool {
+		committed, _, _ := log.state()
+		return committed == 5
+	}, time.Second, time.Millisecond, "the transaction of the message left unacked is aborted and rewound")
+	a.NoError(k.Close(ctx))
+	_, _, aborts := log.state()
+	a.GreaterOrEqual(aborts, 1)
+}
+
+func TestKQExactlyOnceNeedsTransactions(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	k := newTestKQ(ctx, newTestInput(1, 0), &testTransformer{}, &testOutput{},
+		WithExactlyOnce(TransactionOptions{}))
+	a.ErrorIs(k.Run(ctx), ErrNotTransactional)
+}